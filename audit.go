@@ -0,0 +1,101 @@
+package vlog
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoAuditOutputter = errors.New("vlog: there is no audit outputter")
+
+//审计outputter的drop规则匹配时记录未写入，Audit返回此错误
+var errAuditDropped = errors.New("audit record dropped by a redact rule")
+
+// Writes an audit record to the outputters with audit="true" and returns after
+// it is written, the error tells if any audit outputter failed to write it.
+// Audit records are never filtered by level or filters, and are not written to
+// the other outputters. The record's level is LvImportant, its message is
+// "user=... action=... target=... result=...", and user, action, target,
+// result and details are its fields, written by %fields. A record dropped by a
+// redact rule with action="drop" of an audit outputter is reported as an error.
+func Audit(user, action, target, result string, details Fields) error {
+	context, err := specificContextWithStack(1, 0)
+	if err != nil {
+		return err
+	}
+	fields := make(Fields, len(details)+4)
+	for k, v := range details {
+		fields[k] = v
+	}
+	fields["user"] = user
+	fields["action"] = action
+	fields["target"] = target
+	fields["result"] = result
+	if lc, ok := context.(*logContext); ok {
+		lc.fields = fields
+	}
+	message := fmt.Sprintf("user=%s action=%s target=%s result=%s", user, action, target, result)
+
+	log := getLogger()
+	if log == nil {
+		return ErrNoAuditOutputter
+	}
+	return log.audit(message, context)
+}
+
+func (log *logger) audit(message string, context runtimeContextInterface) error {
+	//持有读锁，Shutdown之后不再写入
+	log.sendLock.RLock()
+	defer log.sendLock.RUnlock()
+	if log.isStopped {
+		return ErrLoggerClosed
+	}
+	vlogStats.messageCounter(LvImportant).Add(1)
+	return log.disp.audit(message, context)
+}
+
+// 同步写入所有审计outputter，返回各outputter的错误
+func (disp *dispatcher) audit(message string, context runtimeContextInterface) error {
+	disp.auditLock.Lock()
+	defer disp.auditLock.Unlock()
+	isWritten := false
+	errMsg := ""
+	for _, writer := range disp.writers {
+		if !writer.isAudit {
+			continue
+		}
+		isWritten = true
+		start := time.Now()
+		err := writeAudit(writer, message, context)
+		writer.stats.record(time.Since(start), err)
+		if err != nil {
+			errMsg += writer.writerType + ": " + err.Error() + ","
+		}
+	}
+	if !isWritten {
+		return ErrNoAuditOutputter
+	}
+	if errMsg != "" {
+		return errors.New("vlog audit error: " + errMsg[:len(errMsg)-1])
+	}
+	return nil
+}
+
+// 不检查日志等级和filter
+func writeAudit(writer *formattedWriter, message string, context runtimeContextInterface) (err error) {
+	defer func() {
+		if e, ok := recover().(error); ok {
+			err = e
+			writeRuntimeError(e)
+		}
+	}()
+	if writer.redactor != nil {
+		//drop规则匹配时write返回nil，审计记录未写入须返回错误
+		var ok bool
+		message, context, ok = writer.redactor.redact(message, context)
+		if !ok {
+			return errAuditDropped
+		}
+	}
+	return writer.writeRedacted(message, LvImportant, context)
+}
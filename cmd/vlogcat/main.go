@@ -0,0 +1,88 @@
+//
+// vlogcat prints log files, decrypting the files written with encrypt="aes-gcm".
+//
+// Usage:
+//
+//	vlogcat [-decrypt (-keyenv name | -keyfile file)] file...
+//
+// The key is 16, 24 or 32 bytes encoded by hex or base64, the same as the
+// encryptkeyenv and encryptkeyfile attributes. Damaged frames are skipped and
+// reported, the exit status is 1 if any file was damaged or could not be read.
+// Flags may also be written with two dashes, e.g. --decrypt.
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/kingsmanzhang/vlog"
+)
+
+func main() {
+	decrypt := flag.Bool("decrypt", false, "decrypt the files written with encrypt=\"aes-gcm\"")
+	keyEnv := flag.String("keyenv", "", "read the key from the environment variable")
+	keyFile := flag.String("keyfile", "", "read the key from file")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vlogcat [-decrypt (-keyenv name | -keyfile file)] file...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || (*decrypt && (*keyEnv == "") == (*keyFile == "")) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var key []byte
+	if *decrypt {
+		var err error
+		if *keyEnv != "" {
+			key, err = vlog.ParseEncryptKey(os.Getenv(*keyEnv))
+		} else {
+			var content []byte
+			content, err = ioutil.ReadFile(*keyFile)
+			if err == nil {
+				key, err = vlog.ParseEncryptKey(string(content))
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	isFailed := false
+	for _, fileName := range flag.Args() {
+		err := cat(fileName, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fileName+":", err)
+			isFailed = true
+		}
+	}
+	if isFailed {
+		os.Exit(1)
+	}
+}
+
+func cat(fileName string, key []byte) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if key == nil {
+		_, err = io.Copy(os.Stdout, file)
+		return err
+	}
+	skipped, err := vlog.DecryptLog(os.Stdout, file, key)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%d damaged bytes skipped, the file was torn by a crash, modified or the key is wrong", skipped)
+	}
+	return nil
+}
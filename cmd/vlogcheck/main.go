@@ -0,0 +1,45 @@
+//
+// vlogcheck checks vlog configuration files, for use in CI.
+//
+// Usage:
+//
+//	vlogcheck [-strict] file...
+//
+// Every problem is printed as file:line:column: severity: message, the exit
+// status is 1 if any error was found, or any warning with -strict.
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kingsmanzhang/vlog"
+)
+
+func main() {
+	strict := flag.Bool("strict", false, "treat warnings as errors")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vlogcheck [-strict] file...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	isFailed := false
+	for _, fileName := range flag.Args() {
+		for _, problem := range vlog.Validate(fileName) {
+			fmt.Println(problem)
+			if !problem.Warning || *strict {
+				isFailed = true
+			}
+		}
+	}
+	if isFailed {
+		os.Exit(1)
+	}
+}
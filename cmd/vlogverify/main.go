@@ -0,0 +1,71 @@
+//
+// vlogverify verifies the log files written with integrity="sha256-chain".
+//
+// Usage:
+//
+//	vlogverify [-key key | -keyfile file] filename...
+//
+// filename is the filename attribute of the file outputter, e.g. logs/app_###.log,
+// the rotated files are verified in the order of their numbers. The checkpoints
+// are verified only if a key is given. The exit status is 1 if a tampered line was found.
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/kingsmanzhang/vlog"
+)
+
+func main() {
+	key := flag.String("key", "", "the integritykey of the outputter")
+	keyFile := flag.String("keyfile", "", "read the integritykey from file")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vlogverify [-key key | -keyfile file] filename...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || (*key != "" && *keyFile != "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var keyBytes []byte
+	if *key != "" {
+		keyBytes = []byte(*key)
+	}
+	if *keyFile != "" {
+		content, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		keyBytes = []byte(strings.TrimRight(string(content), "\r\n"))
+	}
+	if keyBytes == nil {
+		fmt.Fprintln(os.Stderr, "warning: no key given, the checkpoints are not verified")
+	}
+
+	isFailed := false
+	for _, fileName := range flag.Args() {
+		report, err := vlog.VerifyIntegrity(fileName, keyBytes)
+		if err != nil {
+			fmt.Println(err)
+			isFailed = true
+			continue
+		}
+		if len(report.Missing) > 0 {
+			fmt.Printf("%s: warning: the files numbered %v were removed, verified from the checkpoint after them\n",
+				fileName, report.Missing)
+		}
+		fmt.Printf("%s: ok, %d files, %d records, %d checkpoints, %d records after the last checkpoint\n",
+			fileName, len(report.Files), report.Records, report.Checkpoints, report.Unsigned)
+	}
+	if isFailed {
+		os.Exit(1)
+	}
+}
@@ -2,20 +2,34 @@ package vlog
 
 import (
 	"errors"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+)
 
-	xml "tangacg.com/xmlnode"
+// 支持的配置文件格式
+const (
+	ConfigFormatXML  = "xml"
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+	ConfigFormatTOML = "toml"
 )
 
 type configuration struct {
-	writersNode    *xml.Node
-	formattersNode *xml.Node
-	maxLevel       LogLevel
-	minLevel       LogLevel
-	writers        []*formattedWriter
-	formatters     map[string]*formatter
+	maxLevel   LogLevel
+	minLevel   LogLevel
+	writers    []*formattedWriter
+	formatters map[string]*formatter
+	exceptions []*levelException
+	redacts    []RedactRule //适用于全部outputter，先于outputter自身的规则
+	//运行时错误日志文件名，为空时使用RUNTIME_ERROR_LOG_FILENAME
+	runtimeErrorLogFileName string
+	//运行时错误日志及file、rulefile默认的权限和属组
+	permissions filePermissions
 }
 
 func loadConfigurationFromFile(fileName string) (config *configuration, err error) {
@@ -25,157 +39,430 @@ func loadConfigurationFromFile(fileName string) (config *configuration, err erro
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
+
+	return loadConfiguration(file, configFormatByFileName(fileName), fileName)
+}
+
+// 根据扩展名决定配置文件格式，无法识别的扩展名按XML处理
+func configFormatByFileName(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return ConfigFormatJSON
+	case ".yaml", ".yml":
+		return ConfigFormatYAML
+	case ".toml":
+		return ConfigFormatTOML
+	}
+	return ConfigFormatXML
+}
 
-	var rootNode *xml.Node
-	rootNode, err = xml.UnmarshalConfig(file)
+// source仅用于错误信息
+func loadConfiguration(reader io.Reader, format string, source string) (config *configuration, err error) {
+	var model *configModel
+	model, err = decodeConfigModel(reader, format, source)
 	if err != nil {
 		return nil, err
 	}
-	if rootNode.Name != "vlog" || !rootNode.HasChildren() {
-		return nil, errors.New("config file err: the root element is not vlog or vlog element has no child element. at file " + fileName)
+	model, err = includeConfigModels(model, source, nil)
+	if err != nil {
+		return nil, err
 	}
+	applyConfigEnv(model)
+	return newConfigurationFromModel(model)
+}
 
+func newConfigurationFromModel(model *configModel) (config *configuration, err error) {
 	config = new(configuration)
-	config.maxLevel = LvCritical
-	config.minLevel = LvTrace
+	config.maxLevel = lvHighest
+	config.minLevel = lvLowest
 
-	minLevelStr, ok := rootNode.Attributes["minlevel"]
-	if ok {
-		level, isValid := lv4StringMap[minLevelStr]
+	if model.MinLevel != "" {
+		level, isValid := levelByName(string(model.MinLevel))
 		if !isValid {
-			return nil, errors.New(rootNode.Name + "'s attribute minlevel value is llegal: " + minLevelStr + ".")
+			return nil, errors.New("vlog's attribute minlevel value is llegal: " + string(model.MinLevel) + ".")
 		}
 		config.minLevel = level
 	}
 
-	maxLevelStr, ok := rootNode.Attributes["maxlevel"]
-	if ok {
-		level, isValid := lv4StringMap[maxLevelStr]
+	if model.MaxLevel != "" {
+		level, isValid := levelByName(string(model.MaxLevel))
 		if !isValid {
-			return nil, errors.New(rootNode.Name + "'s attribute maxlevel value is llegal: " + maxLevelStr + ".")
+			return nil, errors.New("vlog's attribute maxlevel value is llegal: " + string(model.MaxLevel) + ".")
 		}
 		config.maxLevel = level
 	}
+	if config.minLevel > config.maxLevel {
+		return nil, errors.New("vlog's attribute minlevel " + config.minLevel.String() +
+			" is greater than maxlevel " + config.maxLevel.String() + ".")
+	}
 
-	for _, elt := range rootNode.Children {
-		switch elt.Name {
-		case "outputters":
-			if config.writersNode != nil {
-				return nil, errors.New("there must be only one outputter element.")
-			}
-			config.writersNode = elt
-		case "formatters":
-			if config.formattersNode != nil {
-				return nil, errors.New("there must be only one outputter element.")
-			}
-			config.formattersNode = elt
-		default:
-			return nil, errors.New("there was a unallowed element " + elt.String() + ".")
+	config.runtimeErrorLogFileName = string(model.RuntimeErrorLog)
+	config.permissions, err = filePermissions{}.overrideByAttrs("vlog", model.FileMode, model.DirMode, model.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exceptionModel := range model.Exceptions {
+		var exception *levelException
+		exception, err = newLevelExceptionByModel(exceptionModel)
+		if err != nil {
+			return nil, err
 		}
+		config.exceptions = append(config.exceptions, exception)
+	}
+
+	for _, redactModel := range model.Redacts {
+		config.redacts = append(config.redacts, parseModelToRedactRule(redactModel))
 	}
 
-	if config.writersNode == nil {
+	if model.Outputters == nil {
 		return nil, errors.New("there was no outputters element.")
 	}
-	if config.formattersNode == nil {
+	if model.Formatters == nil {
 		return nil, errors.New("there was no formatters element.")
 	}
 
-	err = config.initFormatters()
+	err = config.initFormatters(model.Formatters)
 	if err != nil {
 		return nil, err
 	}
-	if !config.formattersNode.HasChildren() || len(config.formatters) == 0 {
+	if len(config.formatters) == 0 {
 		return nil, errors.New("formatters element must have one child element at least named formatter.")
 	}
-	err = config.initWrites()
+	err = config.initWrites(model.Outputters)
 	if err != nil {
 		return nil, err
 	}
-	if !config.writersNode.HasChildren() || len(config.writers) == 0 {
+	if len(config.writers) == 0 {
 		return nil, errors.New("outputters element must have one child element at least.")
 	}
 	return config, nil
 }
 
-func (config *configuration) initWrites() (err error) {
+func newLevelExceptionByModel(model *exceptionModel) (*levelException, error) {
+	minLevel, maxLevel := lvLowest, lvHighest
+	if model.MinLevel != "" {
+		level, isValid := levelByName(string(model.MinLevel))
+		if !isValid {
+			return nil, errors.New("exception's attribute minlevel value is llegal: " + string(model.MinLevel) + ".")
+		}
+		minLevel = level
+	}
+	if model.MaxLevel != "" {
+		level, isValid := levelByName(string(model.MaxLevel))
+		if !isValid {
+			return nil, errors.New("exception's attribute maxlevel value is llegal: " + string(model.MaxLevel) + ".")
+		}
+		maxLevel = level
+	}
+	return newLevelException(string(model.FuncPattern), string(model.FilePattern), minLevel, maxLevel)
+}
+
+func (config *configuration) initWrites(outputters []*outputterModel) (err error) {
 	config.writers = make([]*formattedWriter, 0)
-	for _, elt := range config.writersNode.Children {
+	queues := make([]*asyncQueue, 0, len(outputters))
+	defer func() {
+		if err != nil {
+			//关闭已创建的outputter，避免后面的outputter出错时泄漏打开的文件
+			closeFormattedWriters(config.writers)
+			config.writers = nil
+		}
+	}()
+	for _, model := range outputters {
 		var writer *formattedWriter
-		switch elt.Name {
-		case "rulefile":
-			writer, err = config.newRuleFileFormattedWriterByXMLNode(elt)
-			if err != nil {
-				return err
-			}
-		case "file":
-			writer, err = config.newFileFormattedWriterByXMLNode(elt)
-			if err != nil {
-				return err
-			}
-		case "console":
-			writer, err = config.newConsoleFormattedWriterByXMLNode(elt)
-			if err != nil {
-				return err
-			}
-		case "database":
-			writer, err = config.newDatabaseFormattedWriterByXMLNode(elt)
-			if err != nil {
-				return err
-			}
-		default:
-			return errors.New("there was a unallowed element " + elt.String() + ".")
+		if model.Type == "failover" {
+			writer, err = config.newFailoverFormattedWriterByModel(model)
+		} else {
+			writer, err = config.newFormattedWriterByModel(model)
+		}
+		if err != nil {
+			return err
 		}
 		config.writers = append(config.writers, writer)
+		writer.filters, err = newFiltersByModel(model.Filters)
+		if err != nil {
+			return err
+		}
+		writer.redactor, err = config.newRedactorByModel(model.Redacts)
+		if err != nil {
+			return err
+		}
+		writer.isAudit, err = parseAuditAttr(model)
+		if err != nil {
+			return err
+		}
+		var queue *asyncQueue
+		queue, err = parseAsyncAttr(model)
+		if err != nil {
+			return err
+		}
+		queues = append(queues, queue)
+	}
+	//全部outputter解析成功后才开启异步写入的goroutine
+	for i, queue := range queues {
+		if queue != nil {
+			config.writers[i].startAsync(queue)
+		}
+	}
+	return nil
+}
+
+// 加载配置出错时关闭已创建的outputter，关闭的错误被忽略
+func closeFormattedWriters(writers []*formattedWriter) {
+	for _, writer := range writers {
+		writer.Close()
+	}
+}
+
+// 解析buffersize、flushinterval、fsync属性
+func parseFlushPolicyAttr(model *outputterModel, writer *formattedWriter) error {
+	policy, err := parseModelToFlushPolicy(model)
+	if err != nil {
+		return err
+	}
+	return enableFlushPolicy(model.Type, writer, policy)
+}
+
+func parseModelToFlushPolicy(model *outputterModel) (policy fileFlushPolicy, err error) {
+	bufferSize := 0
+	if model.BufferSize != "" {
+		var size int64
+		size, err = parseSize(string(model.BufferSize))
+		if err != nil {
+			return policy, errors.New(model.Type + "'s attribute buffersize value is illegal: " + err.Error())
+		}
+		if size > math.MaxInt32 {
+			return policy, errors.New(model.Type + "'s attribute buffersize value is illegal: " + string(model.BufferSize) + " is larger than 2GB.")
+		}
+		bufferSize = int(size)
+	}
+	var flushInterval time.Duration
+	if model.FlushInterval != "" {
+		flushInterval, err = parseDuration(string(model.FlushInterval))
+		if err != nil {
+			return policy, errors.New(model.Type + "'s attribute flushinterval value is illegal: " + err.Error())
+		}
+	}
+	policy, err = newFileFlushPolicy(bufferSize, flushInterval, string(model.Fsync))
+	if err != nil {
+		return policy, errors.New(model.Type + "'s attribute " + err.Error())
+	}
+	return policy, nil
+}
+
+// 解析file、rulefile、database的idletimeout属性
+func parseIdleTimeoutAttr(model *outputterModel, writer *formattedWriter) error {
+	timeout, err := parseModelToIdleTimeout(model)
+	if err != nil {
+		return err
+	}
+	return enableIdleTimeout(model.Type, writer, timeout)
+}
+
+func parseModelToIdleTimeout(model *outputterModel) (timeout time.Duration, err error) {
+	if model.IdleTimeout == "" {
+		return 0, nil
+	}
+	timeout, err = parseDuration(string(model.IdleTimeout))
+	if err != nil {
+		return 0, errors.New(model.Type + "'s attribute idletimeout value is illegal: " + err.Error())
+	}
+	return timeout, nil
+}
+
+// 设置打开的文件或数据库连接空闲多久后关闭，timeout为0时使用默认值
+func enableIdleTimeout(name string, writer *formattedWriter, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		w.maxIdleTime = timeout
+	case *ruleFileWriter:
+		w.maxIdleTime = timeout
+	case *databaseWriter:
+		w.maxIdleTime = timeout
+	default:
+		return errors.New(name + " does not support the idletimeout attribute.")
 	}
 	return nil
 }
 
-func (config *configuration) initFormatters() (err error) {
+// 解析filemode、dirmode、group属性，未设置的使用vlog元素的设置
+func (config *configuration) parsePermissionsAttr(model *outputterModel, writer *formattedWriter) error {
+	perm, err := config.permissions.overrideByAttrs(model.Type, model.FileMode, model.DirMode, model.Group)
+	if err != nil {
+		return err
+	}
+	return enablePermissions(model.Type, writer, perm)
+}
+
+func parseLockFileAttr(model *outputterModel, writer *formattedWriter) error {
+	switch model.LockFile {
+	case "", "false":
+		return nil
+	case "true":
+		return enableLockFile(model.Type, writer)
+	}
+	return errors.New(model.Type + "'s attribute lockfile value is illegal: " + string(model.LockFile) + ".")
+}
+
+func parseReopenOnMoveAttr(model *outputterModel, writer *formattedWriter) error {
+	switch model.ReopenOnMove {
+	case "", "false":
+		return nil
+	case "true":
+		return enableReopenOnMove(model.Type, writer)
+	}
+	return errors.New(model.Type + "'s attribute reopenonmove value is illegal: " + string(model.ReopenOnMove) + ".")
+}
+
+// 解析encrypt、encryptkeyenv、encryptkeyfile属性，需要时为file、rulefile开启加密
+func parseEncryptAttr(model *outputterModel, writer *formattedWriter) error {
+	if model.Encrypt == "" {
+		return nil
+	}
+	key, err := loadEncryptKey(string(model.EncryptKeyEnv), string(model.EncryptKeyFile))
+	if err != nil {
+		return errors.New(model.Type + "'s attribute " + err.Error())
+	}
+	return enableEncryption(model.Type, writer, string(model.Encrypt), key)
+}
+
+// 审计outputter须同步写入，不能同时设置async="true"
+func parseAuditAttr(model *outputterModel) (isAudit bool, err error) {
+	switch model.Audit {
+	case "", "false":
+		return false, nil
+	case "true":
+		if model.Async == "true" {
+			return false, errors.New(model.Type + " with audit=\"true\" can not be async.")
+		}
+		return true, nil
+	}
+	return false, errors.New(model.Type + "'s attribute audit value is illegal: " + string(model.Audit) + ".")
+}
+
+// queuesize为消息条数，只能是正整数，不能带大小单位
+func parseModelToQueueSize(model *outputterModel) (int, error) {
+	if model.QueueSize == "" {
+		return 0, nil
+	}
+	text := string(model.QueueSize)
+	size, err := strconv.Atoi(text)
+	if err != nil {
+		//能按大小解析说明带了单位，如2K、1MB
+		if _, sizeErr := parseSize(text); sizeErr == nil {
+			return 0, errors.New(model.Type + "'s attribute queuesize value is illegal: " + text +
+				" has a unit, queuesize is a number of messages.")
+		}
+		return 0, errors.New(model.Type + "'s attribute queuesize value is illegal: " + text + " is not an integer.")
+	}
+	if size <= 0 {
+		return 0, errors.New(model.Type + "'s attribute queuesize value is illegal: " + text + " is not positive.")
+	}
+	if size > MaxAsyncQueueSize {
+		return 0, errors.New(model.Type + "'s attribute queuesize value is illegal: " + text +
+			" is larger than " + strconv.Itoa(MaxAsyncQueueSize) + ".")
+	}
+	return size, nil
+}
+
+// 解析async、queuesize、overflow属性，返回nil表示同步写入，由调用者开启异步写入
+func parseAsyncAttr(model *outputterModel) (queue *asyncQueue, err error) {
+	if model.Async != "true" {
+		return nil, nil
+	}
+	queueSize, err := parseModelToQueueSize(model)
+	if err != nil {
+		return nil, err
+	}
+	queue, err = newAsyncQueue(queueSize, string(model.Overflow))
+	if err != nil {
+		return nil, errors.New(model.Type + "'s attribute " + err.Error())
+	}
+	return queue, nil
+}
+
+func (config *configuration) newFormattedWriterByModel(model *outputterModel) (writer *formattedWriter, err error) {
+	switch model.Type {
+	case "rulefile":
+		return config.newRuleFileFormattedWriterByModel(model)
+	case "file":
+		return config.newFileFormattedWriterByModel(model)
+	case "console":
+		return config.newConsoleFormattedWriterByModel(model)
+	case "database":
+		return config.newDatabaseFormattedWriterByModel(model)
+	}
+	return nil, errors.New("there was a unallowed element " + model.Type + ".")
+}
+
+func (config *configuration) initFormatters(formatters []*formatterModel) (err error) {
 	config.formatters = make(map[string]*formatter, 0)
-	for _, elt := range config.formattersNode.Children {
+	for _, model := range formatters {
 		var formatterID string
 		var formatter *formatter
-		if elt.Name == "formatter" {
-			formatterID, formatter, err = newFormatterByXMLNode(elt)
-			if err != nil {
-				config.formatters = nil
-				return err
-			}
-		} else {
-			return errors.New("there was a unallowed element " + elt.String() + ".")
+		formatterID, formatter, err = newFormatterByModel(model)
+		if err != nil {
+			config.formatters = nil
+			return err
+		}
+		if _, ok := config.formatters[formatterID]; ok {
+			config.formatters = nil
+			return errors.New("formatter id " + formatterID + " is duplicated.")
 		}
 		config.formatters[formatterID] = formatter
 	}
 	return nil
 }
 
-func newFormatterByXMLNode(node *xml.Node) (formatterID string, formatter *formatter, err error) {
-	fmtID, ok := node.Attributes["id"]
-	if !ok {
-		return "", nil, errors.New(node.Name + " must have id attribute")
+func newFormatterByModel(model *formatterModel) (formatterID string, formatter *formatter, err error) {
+	if model.ID == "" {
+		return "", nil, errors.New("formatter must have id attribute")
 	}
-	fmtString, ok := node.Attributes["format"]
-	if !ok {
-		return "", nil, errors.New(node.Name + " must have format attribute")
+	if model.Format == "" {
+		return "", nil, errors.New("formatter must have format attribute")
 	}
-	formatter, err = newFormatter(fmtString, nil)
+	formatter, err = newFormatterWithID(string(model.ID), string(model.Format))
 	if err != nil {
 		return "", nil, err
 	}
-	formatterID = fmtID
-	return formatterID, formatter, nil
+	return string(model.ID), formatter, nil
 }
 
-func (config *configuration) newConsoleFormattedWriterByXMLNode(node *xml.Node) (writer *formattedWriter, err error) {
-	_, formatterid, allowedLevelList, _, err := parseNodeAttrToWriterInfo(node)
+func newFormatterWithID(formatterID, formatString string) (formatter *formatter, err error) {
+	formatter, err = newFormatter(formatString, nil)
 	if err != nil {
 		return nil, err
 	}
+	formatter.id = formatterID
+	return formatter, nil
+}
+
+func (config *configuration) getFormatter(formatterid string) (*formatter, error) {
 	formatter, ok := config.formatters[formatterid]
 	if !ok {
 		return nil, errors.New("there was no formatter the id by " + formatterid)
 	}
+	return formatter, nil
+}
+
+func (config *configuration) newConsoleFormattedWriterByModel(model *outputterModel) (writer *formattedWriter, err error) {
+	_, formatterid, allowedLevelList, _, err := parseModelToWriterInfo(model)
+	if err != nil {
+		return nil, err
+	}
+	return config.newConsoleFormattedWriter(formatterid, allowedLevelList)
+}
+
+func (config *configuration) newConsoleFormattedWriter(formatterid string,
+	allowedLevelList map[LogLevel]bool) (writer *formattedWriter, err error) {
+	formatter, err := config.getFormatter(formatterid)
+	if err != nil {
+		return nil, err
+	}
 
 	var cw *consoleWriter
 	cw, err = newConsoleWriter()
@@ -189,17 +476,54 @@ func (config *configuration) newConsoleFormattedWriterByXMLNode(node *xml.Node)
 	return writer, nil
 }
 
-func (config *configuration) newFileFormattedWriterByXMLNode(node *xml.Node) (writer *formattedWriter, err error) {
-	fileName, formatterid, allowedLevelList, maxSize, err := parseNodeAttrToWriterInfo(node)
+func (config *configuration) newFileFormattedWriterByModel(model *outputterModel) (writer *formattedWriter, err error) {
+	fileName, formatterid, allowedLevelList, maxSize, err := parseModelToWriterInfo(model)
+	if err != nil {
+		return nil, err
+	}
+	writer, err = config.newFileFormattedWriter(fileName, formatterid, allowedLevelList, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	err = enableIntegrity(model.Type, writer, string(model.Integrity), []byte(model.IntegrityKey))
+	if err != nil {
+		return nil, err
+	}
+	err = parseFlushPolicyAttr(model, writer)
 	if err != nil {
 		return nil, err
 	}
+	err = parseReopenOnMoveAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	err = enableSymlink(model.Type, writer, string(model.Symlink))
+	if err != nil {
+		return nil, err
+	}
+	err = parseIdleTimeoutAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	err = config.parsePermissionsAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	err = parseLockFileAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	return writer, parseEncryptAttr(model, writer)
+}
+
+func (config *configuration) newFileFormattedWriter(fileName, formatterid string,
+	allowedLevelList map[LogLevel]bool, maxSize int64) (writer *formattedWriter, err error) {
 	if fileName == "" {
-		return nil, errors.New(node.Name + " element has no filename attribute")
+		return nil, errors.New("file element has no filename attribute")
 	}
-	formatter, ok := config.formatters[formatterid]
-	if !ok {
-		return nil, errors.New("there was no formatter the id by " + formatterid)
+	formatter, err := config.getFormatter(formatterid)
+	if err != nil {
+		return nil, err
 	}
 	var fw *fileWriter
 	fw, err = newFileWriter(fileName, maxSize, true)
@@ -214,17 +538,54 @@ func (config *configuration) newFileFormattedWriterByXMLNode(node *xml.Node) (wr
 	return writer, nil
 }
 
-func (config *configuration) newRuleFileFormattedWriterByXMLNode(node *xml.Node) (writer *formattedWriter, err error) {
-	fileName, formatterid, allowedLevelList, maxSize, err := parseNodeAttrToWriterInfo(node)
+func (config *configuration) newRuleFileFormattedWriterByModel(model *outputterModel) (writer *formattedWriter, err error) {
+	fileName, formatterid, allowedLevelList, maxSize, err := parseModelToWriterInfo(model)
+	if err != nil {
+		return nil, err
+	}
+	writer, err = config.newRuleFileFormattedWriter(fileName, formatterid, allowedLevelList, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	err = enableIntegrity(model.Type, writer, string(model.Integrity), []byte(model.IntegrityKey))
 	if err != nil {
 		return nil, err
 	}
+	err = parseFlushPolicyAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	err = parseReopenOnMoveAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	err = enableSymlink(model.Type, writer, string(model.Symlink))
+	if err != nil {
+		return nil, err
+	}
+	err = parseIdleTimeoutAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	err = config.parsePermissionsAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	err = parseLockFileAttr(model, writer)
+	if err != nil {
+		return nil, err
+	}
+	return writer, parseEncryptAttr(model, writer)
+}
+
+func (config *configuration) newRuleFileFormattedWriter(fileName, formatterid string,
+	allowedLevelList map[LogLevel]bool, maxSize int64) (writer *formattedWriter, err error) {
 	if fileName == "" {
-		return nil, errors.New(node.Name + " element has no filename attribute")
+		return nil, errors.New("rulefile element has no filename attribute")
 	}
-	formatter, ok := config.formatters[formatterid]
-	if !ok {
-		return nil, errors.New("there was no formatter the id by " + formatterid)
+	formatter, err := config.getFormatter(formatterid)
+	if err != nil {
+		return nil, err
 	}
 	var rfw *ruleFileWriter
 	rfw, err = newRuleFileWriter(fileName, maxSize)
@@ -238,11 +599,23 @@ func (config *configuration) newRuleFileFormattedWriterByXMLNode(node *xml.Node)
 	return writer, nil
 }
 
-func (config *configuration) newDatabaseFormattedWriterByXMLNode(node *xml.Node) (writer *formattedWriter, err error) {
-	dbType, connUrl, tableName, formatterid, allowedLevelList, err := parseNodeAttrToDBWriterInfo(node)
-	formatter, ok := config.formatters[formatterid]
-	if !ok {
-		return nil, errors.New("there was no formatter the id by " + formatterid)
+func (config *configuration) newDatabaseFormattedWriterByModel(model *outputterModel) (writer *formattedWriter, err error) {
+	dbType, connUrl, tableName, formatterid, allowedLevelList, err := parseModelToDBWriterInfo(model)
+	if err != nil {
+		return nil, err
+	}
+	writer, err = config.newDatabaseFormattedWriter(dbType, connUrl, tableName, formatterid, allowedLevelList)
+	if err != nil {
+		return nil, err
+	}
+	return writer, parseIdleTimeoutAttr(model, writer)
+}
+
+func (config *configuration) newDatabaseFormattedWriter(dbType, connUrl, tableName, formatterid string,
+	allowedLevelList map[LogLevel]bool) (writer *formattedWriter, err error) {
+	formatter, err := config.getFormatter(formatterid)
+	if err != nil {
+		return nil, err
 	}
 	var dbWriter *databaseWriter
 	dbWriter, err = newDababaseWriter(dbType, connUrl, tableName)
@@ -256,77 +629,211 @@ func (config *configuration) newDatabaseFormattedWriterByXMLNode(node *xml.Node)
 	return writer, nil
 }
 
-func parseNodeAttrToDBWriterInfo(node *xml.Node) (dbType, connUrl, tableName, formatterid string,
+func (config *configuration) newFailoverFormattedWriterByModel(model *outputterModel) (writer *formattedWriter, err error) {
+	var retryInterval time.Duration
+	if model.RetryInterval != "" {
+		retryInterval, err = parseDuration(string(model.RetryInterval))
+		if err != nil {
+			return nil, errors.New(model.Type + "'s attribute retryinterval value is illegal: " + err.Error())
+		}
+	}
+	children := make([]*formattedWriter, 0, len(model.Outputters))
+	defer func() {
+		if err != nil {
+			closeFormattedWriters(children)
+		}
+	}()
+	for _, childModel := range model.Outputters {
+		//子outputter由failover同步写入，不能异步，也不能只写入Audit的记录
+		if childModel.Async == "true" {
+			return nil, errors.New(childModel.Type + " in failover can not be async.")
+		}
+		if childModel.Audit == "true" {
+			return nil, errors.New(childModel.Type + " in failover can not be audit.")
+		}
+		var child *formattedWriter
+		child, err = config.newFormattedWriterByModel(childModel)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		child.filters, err = newFiltersByModel(childModel.Filters)
+		if err != nil {
+			return nil, err
+		}
+		child.redactor, err = config.newRedactorByModel(childModel.Redacts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	allowedLevelList, err := parseAllowedLevelList(model)
+	if err != nil {
+		return nil, err
+	}
+	return newFailoverFormattedWriter(children, retryInterval, allowedLevelList)
+}
+
+func newFailoverFormattedWriter(children []*formattedWriter, retryInterval time.Duration,
+	allowedLevelList map[LogLevel]bool) (writer *formattedWriter, err error) {
+	var fw *failoverWriter
+	fw, err = newFailoverWriter(children, retryInterval)
+	if err != nil {
+		return nil, err
+	}
+	//failover本身不格式化消息，使用主outputter的formatter标识
+	writer, err = newFormattedWriter(fw, children[0].formatter, allowedLevelList)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func parseModelToDBWriterInfo(model *outputterModel) (dbType, connUrl, tableName, formatterid string,
 	allowedLevelList map[LogLevel]bool, err error) {
-	var ok bool = false
-	dbType, ok = node.Attributes["type"]
-	if !ok {
+	dbType = string(model.DBType)
+	if dbType == "" {
 		return dbType, connUrl, tableName, formatterid, allowedLevelList,
-			errors.New(node.Name + " must be have type attribute.")
+			errors.New(model.Type + " must be have type attribute.")
 	}
-	connUrl, ok = node.Attributes["connurl"]
-	if !ok {
+	connUrl = string(model.ConnURL)
+	if connUrl == "" {
 		return dbType, connUrl, tableName, formatterid, allowedLevelList,
-			errors.New(node.Name + " must be have connurl attribute.")
+			errors.New(model.Type + " must be have connurl attribute.")
 	}
-	tableName, ok = node.Attributes["tablename"]
-	if !ok {
+	tableName = string(model.TableName)
+	if tableName == "" {
 		return dbType, connUrl, tableName, formatterid, allowedLevelList,
-			errors.New(node.Name + " must be have tablename attribute.")
+			errors.New(model.Type + " must be have tablename attribute.")
 	}
-	formatterid, ok = node.Attributes["formatterid"]
-	if !ok {
+	formatterid = string(model.FormatterID)
+	if formatterid == "" {
 		return dbType, connUrl, tableName, formatterid, allowedLevelList,
-			errors.New(node.Name + " must be have formatterid attribute.")
+			errors.New(model.Type + " must be have formatterid attribute.")
 	}
-	allowedLevelList = parseAllowedLevelList(node)
-	return dbType, connUrl, tableName, formatterid, allowedLevelList, nil
+	allowedLevelList, err = parseAllowedLevelList(model)
+	return dbType, connUrl, tableName, formatterid, allowedLevelList, err
 }
 
-func parseNodeAttrToWriterInfo(node *xml.Node) (fileName, formatterid string,
+func parseModelToWriterInfo(model *outputterModel) (fileName, formatterid string,
 	allowedLevelList map[LogLevel]bool, maxSize int64, err error) {
-	var ok bool = false
-	fileName, ok = node.Attributes["filename"]
-	formatterid, ok = node.Attributes["formatterid"]
-	if !ok {
-		return "", "", nil, 0, errors.New(node.Name + " must have formatterid attribute.")
+	fileName = string(model.FileName)
+	formatterid = string(model.FormatterID)
+	if formatterid == "" {
+		return "", "", nil, 0, errors.New(model.Type + " must have formatterid attribute.")
 	}
-	if maxSizeStr, ok := node.Attributes["maxsize"]; ok {
-		maxSize, err = strconv.ParseInt(maxSizeStr, 10, 64)
+	if model.MaxSize != "" {
+		maxSize, err = parseSize(string(model.MaxSize))
 		if err != nil {
-			return "", "", nil, 0, errors.New(node.Name + "'s attribute maxsize value is illegal: " + err.Error())
+			return "", "", nil, 0, errors.New(model.Type + "'s attribute maxsize value is illegal: " + err.Error())
 		}
 	}
 	if maxSize <= 0 {
 		maxSize = DefaultAllowedFileMaxSize
 	}
-	allowedLevelList = parseAllowedLevelList(node)
+	allowedLevelList, err = parseAllowedLevelList(model)
+	if err != nil {
+		return "", "", nil, 0, err
+	}
 	return fileName, formatterid, allowedLevelList, maxSize, nil
 }
 
-func parseAllowedLevelList(node *xml.Node) (allowedLevelList map[LogLevel]bool) {
-	allowedLevelList = map[LogLevel]bool{
-		LvTrace:    false,
-		LvDebug:    false,
-		LvInfo:     false,
-		LvWarn:     false,
-		LvError:    false,
-		LvCritical: false,
-	}
-	levels, ok := node.Attributes["levels"]
-	if ok {
-		levelsSlice := strings.Split(levels, ",")
-		for _, v := range levelsSlice {
-			level, ok := lv4StringMap[v]
-			if ok {
-				allowedLevelList[level] = true
-			}
-		}
-	} else {
+func parseAllowedLevelList(model *outputterModel) (allowedLevelList map[LogLevel]bool, err error) {
+	if model.Levels == "" {
 		//如果未配置levels属性，则允许全部等级
-		for level, _ := range allowedLevelList {
-			allowedLevelList[level] = true
+		return newAllowedLevelList(nil), nil
+	}
+	levelList, err := parseLevelNames(model.Type, string(model.Levels))
+	if err != nil {
+		return nil, err
+	}
+	return newAllowedLevelList(levelList), nil
+}
+
+// 解析以逗号分隔的等级名，element仅用于错误信息
+func parseLevelNames(element, levels string) ([]LogLevel, error) {
+	levelList := make([]LogLevel, 0)
+	for _, v := range strings.Split(levels, ",") {
+		level, ok := levelByName(strings.TrimSpace(v))
+		if !ok {
+			return nil, errors.New(element + "'s attribute levels value is illegal: unknown level " + v + ".")
+		}
+		levelList = append(levelList, level)
+	}
+	return levelList, nil
+}
+
+func newFiltersByModel(models []*filterModel) (filters []*filter, err error) {
+	rules := make([]FilterRule, 0, len(models))
+	for _, model := range models {
+		var rule FilterRule
+		rule, err = parseModelToFilterRule(model)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return newFilters(rules)
+}
+
+func parseModelToFilterRule(model *filterModel) (rule FilterRule, err error) {
+	switch model.Exclude {
+	case "", "false":
+	case "true":
+		rule.Exclude = true
+	default:
+		return rule, errors.New("filter's attribute exclude value is illegal: " + string(model.Exclude) + ".")
+	}
+	if model.Levels != "" {
+		rule.Levels, err = parseLevelNames("filter", string(model.Levels))
+		if err != nil {
+			return rule, err
+		}
+	}
+	rule.Message = string(model.Message)
+	rule.File = string(model.File)
+	rule.Package = string(model.Package)
+	rule.Func = string(model.Func)
+	rule.Field = string(model.Field)
+	rule.Custom = string(model.Custom)
+	return rule, nil
+}
+
+// 全局的redact规则加上outputter自身的规则
+func (config *configuration) newRedactorByModel(models []*redactModel) (*redactor, error) {
+	rules := append([]RedactRule{}, config.redacts...)
+	for _, model := range models {
+		rules = append(rules, parseModelToRedactRule(model))
+	}
+	return newRedactor(rules)
+}
+
+func parseModelToRedactRule(model *redactModel) (rule RedactRule) {
+	rule.Detectors = splitConfigList(string(model.Detectors))
+	rule.Pattern = string(model.Pattern)
+	rule.Fields = splitConfigList(string(model.Fields))
+	rule.Action = string(model.Action)
+	rule.Key = string(model.Key)
+	return rule
+}
+
+// 以逗号分隔的属性值，忽略空白和空项
+func splitConfigList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
+}
+
+// levels为nil时允许全部等级（包括之后注册的自定义等级），返回nil
+func newAllowedLevelList(levels []LogLevel) (allowedLevelList map[LogLevel]bool) {
+	if levels == nil {
+		return nil
+	}
+	allowedLevelList = make(map[LogLevel]bool, len(levels))
+	for _, level := range levels {
+		allowedLevelList[level] = true
+	}
 	return allowedLevelList
 }
@@ -0,0 +1,478 @@
+package vlog
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// A configuration ready to be passed to InitLogger.
+type Config struct {
+	config *configuration
+}
+
+// ConfigBuilder creates a configuration in code, with the same validation as
+// the configuration file. Errors are reported by Build.
+//
+//	config, err := vlog.NewConfig().
+//		MinLevel(vlog.LvInfo).
+//		Formatter("common", "%date %time [%lv]: %msg%n").
+//		File("logs/app_###.log", "common", vlog.MaxSize(2*1024*1024)).
+//		Console("common", vlog.Levels(vlog.LvWarn, vlog.LvError, vlog.LvCritical)).
+//		Build()
+type ConfigBuilder struct {
+	minLevel        LogLevel
+	maxLevel        LogLevel
+	runtimeErrorLog string
+	formatters      [][2]string //{id, format}
+	exceptions      []*levelException
+	exceptionErr    error //Build时返回
+	fileMode        os.FileMode
+	dirMode         os.FileMode
+	group           string
+	redacts         []RedactRule
+	outputters      []outputterBuilder
+}
+
+// 在所有formatter创建之后才创建outputter，因此formatter与outputter的声明顺序无关。
+// 返回的queue不为nil时为异步outputter，全部outputter创建成功后才开启异步写入
+type outputterBuilder func(config *configuration) (writer *formattedWriter, queue *asyncQueue, err error)
+
+// Optional settings of an outputter.
+type OutputterOption func(options *outputterOptions)
+
+type outputterOptions struct {
+	levels        []LogLevel //nil表示允许全部等级
+	maxSize       int64
+	async         bool
+	queueSize     int
+	overflow      string
+	retryInterval time.Duration
+	filters       []FilterRule
+	audit         bool
+	integrityKey  []byte //不为nil时启用IntegritySHA256Chain
+	encryptKey    []byte //不为nil时启用EncryptAESGCM
+	bufferSize    int
+	flushInterval time.Duration
+	fsync         string
+	reopenOnMove  bool
+	symlink       string
+	idleTimeout   time.Duration
+	lockFile      bool
+	fileMode      os.FileMode //0表示使用ConfigBuilder.Permissions的设置
+	dirMode       os.FileMode
+	group         string
+	redacts       []RedactRule
+}
+
+// Outputs only the given levels, the default is all levels.
+func Levels(levels ...LogLevel) OutputterOption {
+	return func(options *outputterOptions) {
+		options.levels = append([]LogLevel{}, levels...)
+	}
+}
+
+// Sets the maximum size of a log file in bytes, the default is DefaultAllowedFileMaxSize.
+func MaxSize(maxSize int64) OutputterOption {
+	return func(options *outputterOptions) {
+		options.maxSize = maxSize
+	}
+}
+
+// Writes in a separate goroutine with a queue of queueSize messages.
+// overflow is one of "block", "drop", "dropoldest", empty means "block".
+func Async(queueSize int, overflow string) OutputterOption {
+	return func(options *outputterOptions) {
+		options.async = true
+		options.queueSize = queueSize
+		options.overflow = overflow
+	}
+}
+
+// Sets how often a failover retries its primary outputter.
+func RetryInterval(interval time.Duration) OutputterOption {
+	return func(options *outputterOptions) {
+		options.retryInterval = interval
+	}
+}
+
+// Marks the outputter as an audit outputter, which writes only the records of Audit.
+// It can not be used with Async.
+func AuditOutputter() OutputterOption {
+	return func(options *outputterOptions) {
+		options.audit = true
+	}
+}
+
+// Adds a filter, an outputter may have several filters and writes only the
+// messages accepted by all of them.
+func Filter(rule FilterRule) OutputterOption {
+	return func(options *outputterOptions) {
+		options.filters = append(options.filters, rule)
+	}
+}
+
+// Appends a sha256 hash chain to every record of a file or rulefile outputter and
+// signs it with key at rotation and close, see IntegritySHA256Chain and VerifyIntegrity.
+func Integrity(key []byte) OutputterOption {
+	return func(options *outputterOptions) {
+		options.integrityKey = key
+	}
+}
+
+// Buffers the writes of a file or rulefile outputter in size bytes, the buffer is
+// written after flushInterval (DefaultFlushInterval if it is zero), at rotation,
+// close and after a message of LvError or above.
+func Buffer(size int, flushInterval time.Duration) OutputterOption {
+	return func(options *outputterOptions) {
+		options.bufferSize = size
+		options.flushInterval = flushInterval
+	}
+}
+
+// Sets when a file or rulefile outputter syncs to disk, one of FsyncNever (default),
+// FsyncRotation, FsyncInterval and FsyncAlways.
+func Fsync(policy string) OutputterOption {
+	return func(options *outputterOptions) {
+		options.fsync = policy
+	}
+}
+
+// Reopens the file of a file or rulefile outputter when it was moved or deleted,
+// e.g. by logrotate, checked every DefaultMoveCheckInterval.
+func ReopenOnMove() OutputterOption {
+	return func(options *outputterOptions) {
+		options.reopenOnMove = true
+	}
+}
+
+// Keeps a symbolic link pointing to the current file of a file or rulefile
+// outputter, for a rulefile the link name may have the tags of its file name.
+func Symlink(path string) OutputterOption {
+	return func(options *outputterOptions) {
+		options.symlink = path
+	}
+}
+
+// Sets how long an opened file of a file or rulefile outputter, or the connection
+// of a database outputter, is kept while no message is written.
+func IdleTimeout(timeout time.Duration) OutputterOption {
+	return func(options *outputterOptions) {
+		options.idleTimeout = timeout
+	}
+}
+
+// Lets several processes write the same files of a file or rulefile outputter,
+// the file number and the rotation are shared through a flock on a lock file.
+// It can not be used with Buffer or Integrity.
+func LockFile() OutputterOption {
+	return func(options *outputterOptions) {
+		options.lockFile = true
+	}
+}
+
+// Sets the permissions and the group of the files and directories created by a
+// file or rulefile outputter, overriding ConfigBuilder.Permissions. A zero mode
+// or an empty group keeps the default.
+func Permissions(fileMode, dirMode os.FileMode, group string) OutputterOption {
+	return func(options *outputterOptions) {
+		options.fileMode = fileMode
+		options.dirMode = dirMode
+		options.group = group
+	}
+}
+
+// Encrypts a file or rulefile outputter by AES-GCM with key of 16, 24 or 32 bytes,
+// see EncryptAESGCM and DecryptLog. It can not be used with Integrity.
+func Encrypt(key []byte) OutputterOption {
+	return func(options *outputterOptions) {
+		options.encryptKey = key
+	}
+}
+
+// Adds a redaction rule of the outputter, applied after the rules added by ConfigBuilder.Redact.
+func Redact(rule RedactRule) OutputterOption {
+	return func(options *outputterOptions) {
+		options.redacts = append(options.redacts, rule)
+	}
+}
+
+// 启用file、rulefile的缓冲、fsync、symlink、idletimeout、integrity、权限、lockfile、encrypt
+func (options *outputterOptions) enableFileOptions(name string, writer *formattedWriter, perm filePermissions) error {
+	perm, err := perm.override(options.fileMode, options.dirMode, options.group)
+	if err != nil {
+		return errors.New(name + "'s permissions are illegal: " + err.Error())
+	}
+	err = enablePermissions(name, writer, perm)
+	if err != nil {
+		return err
+	}
+	policy, err := newFileFlushPolicy(options.bufferSize, options.flushInterval, options.fsync)
+	if err != nil {
+		return errors.New(name + "'s attribute " + err.Error())
+	}
+	err = enableFlushPolicy(name, writer, policy)
+	if err != nil {
+		return err
+	}
+	err = enableSymlink(name, writer, options.symlink)
+	if err != nil {
+		return err
+	}
+	err = enableIdleTimeout(name, writer, options.idleTimeout)
+	if err != nil {
+		return err
+	}
+	if options.reopenOnMove {
+		err = enableReopenOnMove(name, writer)
+		if err != nil {
+			return err
+		}
+	}
+	if options.integrityKey != nil {
+		err = enableIntegrity(name, writer, IntegritySHA256Chain, options.integrityKey)
+		if err != nil {
+			return err
+		}
+	}
+	if options.lockFile {
+		err = enableLockFile(name, writer)
+		if err != nil {
+			return err
+		}
+	}
+	if options.encryptKey != nil {
+		return enableEncryption(name, writer, EncryptAESGCM, options.encryptKey)
+	}
+	return nil
+}
+
+func newOutputterOptions(opts []OutputterOption) *outputterOptions {
+	options := new(outputterOptions)
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.maxSize <= 0 {
+		options.maxSize = DefaultAllowedFileMaxSize
+	}
+	return options
+}
+
+func NewConfig() *ConfigBuilder {
+	builder := new(ConfigBuilder)
+	builder.minLevel = lvLowest
+	builder.maxLevel = lvHighest
+	return builder
+}
+
+func (builder *ConfigBuilder) MinLevel(level LogLevel) *ConfigBuilder {
+	builder.minLevel = level
+	return builder
+}
+
+func (builder *ConfigBuilder) MaxLevel(level LogLevel) *ConfigBuilder {
+	builder.maxLevel = level
+	return builder
+}
+
+// Sets the file vlog's own runtime errors are written to.
+func (builder *ConfigBuilder) RuntimeErrorLog(fileName string) *ConfigBuilder {
+	builder.runtimeErrorLog = fileName
+	return builder
+}
+
+// Sets the permissions and the group of the runtime error log and, unless an
+// outputter sets its own, of the files and directories created by file and
+// rulefile outputters. A zero mode keeps the default, which is 0666 for files
+// and 0777 for directories minus the umask; an explicit mode is not masked.
+// group is a group name or a gid, empty keeps the group of the process.
+func (builder *ConfigBuilder) Permissions(fileMode, dirMode os.FileMode, group string) *ConfigBuilder {
+	builder.fileMode = fileMode
+	builder.dirMode = dirMode
+	builder.group = group
+	return builder
+}
+
+// Uses the levels from minLevel to maxLevel instead of MinLevel and MaxLevel for
+// the callers matching funcPattern and filePattern, like the exception element.
+// An empty pattern matches all callers, the first matching exception is used.
+func (builder *ConfigBuilder) Exception(funcPattern, filePattern string, minLevel, maxLevel LogLevel) *ConfigBuilder {
+	exception, err := newLevelException(funcPattern, filePattern, minLevel, maxLevel)
+	if err != nil {
+		if builder.exceptionErr == nil {
+			builder.exceptionErr = err
+		}
+		return builder
+	}
+	builder.exceptions = append(builder.exceptions, exception)
+	return builder
+}
+
+// Adds a redaction rule applied to all outputters.
+func (builder *ConfigBuilder) Redact(rule RedactRule) *ConfigBuilder {
+	builder.redacts = append(builder.redacts, rule)
+	return builder
+}
+
+func (builder *ConfigBuilder) Formatter(id, format string) *ConfigBuilder {
+	builder.formatters = append(builder.formatters, [2]string{id, format})
+	return builder
+}
+
+func (builder *ConfigBuilder) Console(formatterID string, opts ...OutputterOption) *ConfigBuilder {
+	return builder.addOutputter("console", opts, func(config *configuration, options *outputterOptions) (*formattedWriter, error) {
+		return config.newConsoleFormattedWriter(formatterID, newAllowedLevelList(options.levels))
+	})
+}
+
+// fileName supports "#" for the auto increment number, like the filename attribute of file element.
+func (builder *ConfigBuilder) File(fileName, formatterID string, opts ...OutputterOption) *ConfigBuilder {
+	return builder.addOutputter("file", opts, func(config *configuration, options *outputterOptions) (*formattedWriter, error) {
+		writer, err := config.newFileFormattedWriter(fileName, formatterID, newAllowedLevelList(options.levels), options.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		return writer, options.enableFileOptions("file", writer, config.permissions)
+	})
+}
+
+// fileName supports the date and level tags, like the filename attribute of rulefile element.
+func (builder *ConfigBuilder) RuleFile(fileName, formatterID string, opts ...OutputterOption) *ConfigBuilder {
+	return builder.addOutputter("rulefile", opts, func(config *configuration, options *outputterOptions) (*formattedWriter, error) {
+		writer, err := config.newRuleFileFormattedWriter(fileName, formatterID, newAllowedLevelList(options.levels), options.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		return writer, options.enableFileOptions("rulefile", writer, config.permissions)
+	})
+}
+
+func (builder *ConfigBuilder) Database(dbType, connUrl, tableName, formatterID string, opts ...OutputterOption) *ConfigBuilder {
+	return builder.addOutputter("database", opts, func(config *configuration, options *outputterOptions) (*formattedWriter, error) {
+		writer, err := config.newDatabaseFormattedWriter(dbType, connUrl, tableName, formatterID, newAllowedLevelList(options.levels))
+		if err != nil {
+			return nil, err
+		}
+		return writer, enableIdleTimeout("database", writer, options.idleTimeout)
+	})
+}
+
+// Adds a failover outputter whose children are the outputters added by children, in order.
+func (builder *ConfigBuilder) Failover(children func(failover *ConfigBuilder), opts ...OutputterOption) *ConfigBuilder {
+	childBuilder := new(ConfigBuilder)
+	children(childBuilder)
+	return builder.addOutputter("failover", opts, func(config *configuration, options *outputterOptions) (*formattedWriter, error) {
+		writers := make([]*formattedWriter, 0, len(childBuilder.outputters))
+		for _, newChild := range childBuilder.outputters {
+			child, queue, err := newChild(config)
+			if err == nil {
+				writers = append(writers, child)
+				//子outputter由failover同步写入，不能异步，也不能只写入Audit的记录
+				if queue != nil {
+					err = errors.New(child.writerType + " in failover can not be async.")
+				} else if child.isAudit {
+					err = errors.New(child.writerType + " in failover can not be audit.")
+				}
+			}
+			if err != nil {
+				closeFormattedWriters(writers)
+				return nil, err
+			}
+		}
+		writer, err := newFailoverFormattedWriter(writers, options.retryInterval, newAllowedLevelList(options.levels))
+		if err != nil {
+			closeFormattedWriters(writers)
+		}
+		return writer, err
+	})
+}
+
+func (builder *ConfigBuilder) addOutputter(name string, opts []OutputterOption,
+	newWriter func(config *configuration, options *outputterOptions) (*formattedWriter, error)) *ConfigBuilder {
+	builder.outputters = append(builder.outputters, func(config *configuration) (writer *formattedWriter, queue *asyncQueue, err error) {
+		options := newOutputterOptions(opts)
+		created, err := newWriter(config, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() {
+			if err != nil {
+				created.Close()
+			}
+		}()
+		writer = created
+		writer.filters, err = newFilters(options.filters)
+		if err != nil {
+			return nil, nil, err
+		}
+		writer.redactor, err = newRedactor(append(append([]RedactRule{}, config.redacts...), options.redacts...))
+		if err != nil {
+			return nil, nil, err
+		}
+		writer.isAudit = options.audit
+		if options.audit && options.async {
+			return nil, nil, errors.New(name + " with audit=\"true\" can not be async.")
+		}
+		if options.async {
+			queue, err = newAsyncQueue(options.queueSize, options.overflow)
+			if err != nil {
+				return nil, nil, errors.New(name + "'s attribute " + err.Error())
+			}
+		}
+		return writer, queue, nil
+	})
+	return builder
+}
+
+// Creates the configuration, returns the first problem found.
+func (builder *ConfigBuilder) Build() (*Config, error) {
+	config := new(configuration)
+	config.minLevel = builder.minLevel
+	config.maxLevel = builder.maxLevel
+	config.runtimeErrorLogFileName = builder.runtimeErrorLog
+	if builder.exceptionErr != nil {
+		return nil, builder.exceptionErr
+	}
+	var err error
+	config.permissions, err = filePermissions{}.override(builder.fileMode, builder.dirMode, builder.group)
+	if err != nil {
+		return nil, errors.New("vlog's permissions are illegal: " + err.Error())
+	}
+	config.exceptions = builder.exceptions
+	config.redacts = builder.redacts
+
+	config.formatters = make(map[string]*formatter, len(builder.formatters))
+	for _, f := range builder.formatters {
+		formatter, err := newFormatterWithID(f[0], f[1])
+		if err != nil {
+			return nil, err
+		}
+		config.formatters[f[0]] = formatter
+	}
+	if len(config.formatters) == 0 {
+		return nil, errors.New("formatters element must have one child element at least named formatter.")
+	}
+
+	if len(builder.outputters) == 0 {
+		return nil, errors.New("outputters element must have one child element at least.")
+	}
+	config.writers = make([]*formattedWriter, 0, len(builder.outputters))
+	queues := make([]*asyncQueue, 0, len(builder.outputters))
+	for _, newWriter := range builder.outputters {
+		writer, queue, err := newWriter(config)
+		if err != nil {
+			//关闭已创建的outputter，避免泄漏打开的文件
+			closeFormattedWriters(config.writers)
+			return nil, err
+		}
+		config.writers = append(config.writers, writer)
+		queues = append(queues, queue)
+	}
+	//全部outputter创建成功后才开启异步写入的goroutine
+	for i, queue := range queues {
+		if queue != nil {
+			config.writers[i].startAsync(queue)
+		}
+	}
+	return &Config{config}, nil
+}
@@ -0,0 +1,66 @@
+package vlog
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// 优先于配置文件的环境变量
+const (
+	EnvConfig   = "VLOG_CONFIG"   //配置文件名，优先于InitLoggerWithFile的参数
+	EnvMinLevel = "VLOG_MINLEVEL" //优先于vlog元素的minlevel属性
+	EnvMaxLevel = "VLOG_MAXLEVEL" //优先于vlog元素的maxlevel属性
+)
+
+// ${NAME}或${NAME:default}
+var configEnvReg = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// 替换属性值中的环境变量引用，环境变量未设置时使用默认值（没有默认值时为空）
+func expandConfigValue(value string) string {
+	if !strings.Contains(value, "${") {
+		return value
+	}
+	return configEnvReg.ReplaceAllStringFunc(value, func(ref string) string {
+		match := configEnvReg.FindStringSubmatch(ref)
+		if env, ok := os.LookupEnv(match[1]); ok {
+			return env
+		}
+		return match[2]
+	})
+}
+
+// 替换模型中所有属性值的环境变量引用，再应用环境变量覆盖
+func applyConfigEnv(model *configModel) {
+	expandModelValues(reflect.ValueOf(model))
+	if minLevel := os.Getenv(EnvMinLevel); minLevel != "" {
+		model.MinLevel = configValue(minLevel)
+	}
+	if maxLevel := os.Getenv(EnvMaxLevel); maxLevel != "" {
+		model.MaxLevel = configValue(maxLevel)
+	}
+}
+
+func expandModelValues(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			expandModelValues(value.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			expandModelValues(value.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath == "" {
+				expandModelValues(value.Field(i))
+			}
+		}
+	case reflect.String:
+		if value.Type() == reflect.TypeOf(configValue("")) {
+			value.SetString(expandConfigValue(value.String()))
+		}
+	}
+}
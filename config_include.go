@@ -0,0 +1,130 @@
+package vlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 合并配置中include的文件。被include的文件先于当前文件合并，因此当前文件中的
+// vlog属性和同id的formatter覆盖被include文件中的定义，exception优先于被include文件中的，
+// outputter按顺序追加。同一文件中或并列include的文件中重复的formatter id保留下来，
+// 由加载和Validate报告。
+// include的文件名相对于当前文件所在目录，chain为正在合并的文件（绝对路径），用于检测循环引用。
+func includeConfigModels(model *configModel, source string, chain []string) (*configModel, error) {
+	return includeConfigModelsOnce(model, source, chain, make(map[string]bool))
+}
+
+// included为已合并的文件（绝对路径），被多个文件include的文件只合并一次
+func includeConfigModelsOnce(model *configModel, source string, chain []string,
+	included map[string]bool) (*configModel, error) {
+	if len(model.Include) == 0 {
+		return model, nil
+	}
+	if absSource, err := filepath.Abs(source); err == nil {
+		chain = append(chain, absSource)
+	}
+
+	merged := new(configModel)
+	for _, include := range model.Include {
+		if include.File == "" {
+			return nil, errors.New("include element has no file attribute. at file " + source)
+		}
+		fileName := expandConfigValue(string(include.File))
+		if !filepath.IsAbs(fileName) {
+			fileName = filepath.Join(filepath.Dir(source), fileName)
+		}
+		absFileName, err := filepath.Abs(fileName)
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range chain {
+			if name == absFileName {
+				return nil, errors.New("config file include cycle: " +
+					strings.Join(append(chain[i:], absFileName), " -> "))
+			}
+		}
+
+		if included[absFileName] {
+			continue
+		}
+		included[absFileName] = true
+
+		includedModel, err := decodeConfigModelFromFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		includedModel, err = includeConfigModelsOnce(includedModel, fileName, chain, included)
+		if err != nil {
+			return nil, err
+		}
+		mergeConfigModel(merged, includedModel, false)
+	}
+	mergeConfigModel(merged, model, true)
+	return merged, nil
+}
+
+func decodeConfigModelFromFile(fileName string) (*configModel, error) {
+	file, err := os.OpenFile(fileName, os.O_RDONLY, defaultFilePermissions)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeConfigModel(file, configFormatByFileName(fileName), fileName)
+}
+
+// 将src合并到dst，src中的定义优先，isOverride为false时同id的formatter不覆盖
+func mergeConfigModel(dst, src *configModel, isOverride bool) {
+	if src.MinLevel != "" {
+		dst.MinLevel = src.MinLevel
+	}
+	if src.MaxLevel != "" {
+		dst.MaxLevel = src.MaxLevel
+	}
+	if src.RuntimeErrorLog != "" {
+		dst.RuntimeErrorLog = src.RuntimeErrorLog
+	}
+	if src.FileMode != "" {
+		dst.FileMode = src.FileMode
+	}
+	if src.DirMode != "" {
+		dst.DirMode = src.DirMode
+	}
+	if src.Group != "" {
+		dst.Group = src.Group
+	}
+	if src.Outputters != nil && dst.Outputters == nil {
+		dst.Outputters = make(outputterModels, 0, len(src.Outputters))
+	}
+	dst.Outputters = append(dst.Outputters, src.Outputters...)
+	if src.Formatters != nil && dst.Formatters == nil {
+		dst.Formatters = make([]*formatterModel, 0, len(src.Formatters))
+	}
+	if isOverride {
+		dst.Formatters = overrideFormatterModels(dst.Formatters, src.Formatters)
+	} else {
+		dst.Formatters = append(dst.Formatters, src.Formatters...)
+	}
+	//第一个匹配的exception生效，src中的exception优先
+	dst.Exceptions = append(append([]*exceptionModel{}, src.Exceptions...), dst.Exceptions...)
+	//redact规则全部生效
+	dst.Redacts = append(dst.Redacts, src.Redacts...)
+	dst.pos = src.pos
+	dst.unknownAttrs = src.unknownAttrs
+}
+
+// 去掉formatters中与overrides同id的定义后追加overrides，overrides中重复的id不合并
+func overrideFormatterModels(formatters, overrides []*formatterModel) []*formatterModel {
+	ids := make(map[configValue]bool, len(overrides))
+	for _, formatter := range overrides {
+		ids[formatter.ID] = true
+	}
+	merged := formatters[:0]
+	for _, formatter := range formatters {
+		if formatter.ID == "" || !ids[formatter.ID] {
+			merged = append(merged, formatter)
+		}
+	}
+	return append(merged, overrides...)
+}
@@ -0,0 +1,582 @@
+package vlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// 与配置文件格式无关的配置模型，各格式的配置文件都先解析为configModel。
+// 字段名（json tag）与XML配置文件的属性名一致，例如YAML：
+//
+//	minlevel: info
+//	outputters:
+//	  - file: {formatterid: common, filename: "logs/log_###.log"}
+//	  - console: {formatterid: common}
+//	formatters:
+//	  - {id: common, format: "%date %time [%lv]: %msg%n"}
+type configModel struct {
+	MinLevel        configValue       `json:"minlevel"`
+	MaxLevel        configValue       `json:"maxlevel"`
+	RuntimeErrorLog configValue       `json:"runtimeerrorlog"`
+	FileMode        configValue       `json:"filemode"` //file、rulefile及运行时错误日志的默认权限
+	DirMode         configValue       `json:"dirmode"`
+	Group           configValue       `json:"group"`
+	Outputters      outputterModels   `json:"outputters"`
+	Formatters      []*formatterModel `json:"formatters"`
+	Include         []*includeModel   `json:"include"` //引用的其他配置文件
+	Exceptions      []*exceptionModel `json:"exceptions"`
+	Redacts         []*redactModel    `json:"redacts"` //适用于全部outputter
+	pos             configPosition
+	unknownAttrs    []string
+}
+
+type exceptionModel struct {
+	FuncPattern  configValue `json:"funcpattern"`
+	FilePattern  configValue `json:"filepattern"`
+	MinLevel     configValue `json:"minlevel"`
+	MaxLevel     configValue `json:"maxlevel"`
+	pos          configPosition
+	unknownAttrs []string
+}
+
+type includeModel struct {
+	File         configValue `json:"file"`
+	pos          configPosition
+	unknownAttrs []string
+}
+
+type formatterModel struct {
+	ID           configValue `json:"id"`
+	Format       configValue `json:"format"`
+	pos          configPosition
+	unknownAttrs []string
+}
+
+type outputterModel struct {
+	Type           string          `json:"-"` //outputter类型，即XML元素名
+	FormatterID    configValue     `json:"formatterid"`
+	Levels         configValue     `json:"levels"`
+	FileName       configValue     `json:"filename"`
+	MaxSize        configValue     `json:"maxsize"`
+	DBType         configValue     `json:"type"`
+	ConnURL        configValue     `json:"connurl"`
+	TableName      configValue     `json:"tablename"`
+	Async          configValue     `json:"async"`
+	QueueSize      configValue     `json:"queuesize"`
+	Overflow       configValue     `json:"overflow"`
+	RetryInterval  configValue     `json:"retryinterval"`
+	Audit          configValue     `json:"audit"`
+	Integrity      configValue     `json:"integrity"`
+	IntegrityKey   configValue     `json:"integritykey"`
+	BufferSize     configValue     `json:"buffersize"`
+	FlushInterval  configValue     `json:"flushinterval"`
+	Fsync          configValue     `json:"fsync"`
+	ReopenOnMove   configValue     `json:"reopenonmove"`
+	Symlink        configValue     `json:"symlink"`
+	IdleTimeout    configValue     `json:"idletimeout"` //打开的文件或数据库连接空闲多久后关闭
+	LockFile       configValue     `json:"lockfile"`    //多个进程写入同一组日志文件
+	FileMode       configValue     `json:"filemode"`    //八进制，如0640
+	DirMode        configValue     `json:"dirmode"`
+	Group          configValue     `json:"group"` //组名或gid
+	Encrypt        configValue     `json:"encrypt"`
+	EncryptKeyEnv  configValue     `json:"encryptkeyenv"`  //保存密钥的环境变量名
+	EncryptKeyFile configValue     `json:"encryptkeyfile"` //保存密钥的文件
+	Outputters     outputterModels `json:"outputters"`     //failover的子outputter
+	Filters        []*filterModel  `json:"filters"`
+	Redacts        []*redactModel  `json:"redacts"`
+	pos            configPosition
+	unknownAttrs   []string //配置文件中无法识别的属性
+}
+
+// 属性与FilterRule的字段对应
+type filterModel struct {
+	Exclude      configValue `json:"exclude"`
+	Levels       configValue `json:"levels"`
+	Message      configValue `json:"message"`
+	File         configValue `json:"file"`
+	Package      configValue `json:"package"`
+	Func         configValue `json:"func"`
+	Field        configValue `json:"field"`
+	Custom       configValue `json:"custom"`
+	pos          configPosition
+	unknownAttrs []string
+}
+
+// 属性与RedactRule的字段对应，detectors、fields以逗号分隔
+type redactModel struct {
+	Detectors    configValue `json:"detectors"`
+	Pattern      configValue `json:"pattern"`
+	Fields       configValue `json:"fields"`
+	Action       configValue `json:"action"`
+	Key          configValue `json:"key"`
+	pos          configPosition
+	unknownAttrs []string
+}
+
+// 元素在配置文件中的位置，行列仅XML配置文件有效，line为零表示未知
+type configPosition struct {
+	file   string
+	line   int
+	column int
+}
+
+// 按顺序排列的outputter，JSON、YAML、TOML中每一项都是以outputter类型为唯一键的对象
+type outputterModels []*outputterModel
+
+func (models *outputterModels) UnmarshalJSON(data []byte) error {
+	var items []map[string]*outputterModel
+	err := json.Unmarshal(data, &items)
+	if err != nil {
+		return err
+	}
+	*models = make(outputterModels, 0, len(items))
+	for _, item := range items {
+		if len(item) != 1 {
+			return errors.New("every item of outputters must have exactly one key, the outputter type.")
+		}
+		for outputterType, model := range item {
+			if model == nil {
+				model = new(outputterModel)
+			}
+			model.Type = outputterType
+			*models = append(*models, model)
+		}
+	}
+	return nil
+}
+
+// 属性值，允许在JSON、YAML、TOML中写成数字或布尔值
+type configValue string
+
+func (value *configValue) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+		*value = configValue(s)
+		return nil
+	}
+	if bytes.Equal(data, []byte("null")) {
+		*value = ""
+		return nil
+	}
+	if len(data) > 0 && (data[0] == '{' || data[0] == '[') {
+		return errors.New("attribute value must be a string, number or boolean: " + string(data))
+	}
+	*value = configValue(data)
+	return nil
+}
+
+func decodeConfigModel(reader io.Reader, format string, source string) (model *configModel, err error) {
+	switch format {
+	case ConfigFormatXML:
+		model, err = decodeXMLConfigModel(reader, source)
+		if err != nil {
+			return nil, err
+		}
+	case ConfigFormatJSON:
+		//先解析为通用数据，与YAML、TOML一样检查无法识别的属性
+		decoder := json.NewDecoder(reader)
+		decoder.UseNumber()
+		var doc interface{}
+		err = decoder.Decode(&doc)
+		if err == nil {
+			model, err = decodeGenericConfigModel(doc)
+		}
+	case ConfigFormatYAML:
+		var data []byte
+		data, err = ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		var doc interface{}
+		err = yaml.Unmarshal(data, &doc)
+		if err == nil {
+			model, err = decodeGenericConfigModel(doc)
+		}
+	case ConfigFormatTOML:
+		var doc map[string]interface{}
+		_, err = toml.DecodeReader(reader, &doc)
+		if err == nil {
+			model, err = decodeGenericConfigModel(doc)
+		}
+	default:
+		return nil, errors.New("unsupported config format: " + format)
+	}
+	if err != nil {
+		return nil, errors.New("config file err: " + err.Error() + ". at file " + source)
+	}
+	setConfigModelSource(model, source)
+	return model, nil
+}
+
+// 记录各元素所在的配置文件
+func setConfigModelSource(model *configModel, source string) {
+	model.pos.file = source
+	for _, formatter := range model.Formatters {
+		formatter.pos.file = source
+	}
+	for _, include := range model.Include {
+		include.pos.file = source
+	}
+	for _, exception := range model.Exceptions {
+		exception.pos.file = source
+	}
+	for _, redact := range model.Redacts {
+		redact.pos.file = source
+	}
+	var setOutputters func(outputters outputterModels)
+	setOutputters = func(outputters outputterModels) {
+		for _, outputter := range outputters {
+			outputter.pos.file = source
+			for _, filter := range outputter.Filters {
+				filter.pos.file = source
+			}
+			for _, redact := range outputter.Redacts {
+				redact.pos.file = source
+			}
+			setOutputters(outputter.Outputters)
+		}
+	}
+	setOutputters(model.Outputters)
+}
+
+// JSON、YAML、TOML解析得到的通用数据先转换为JSON，再统一解析为configModel
+func decodeGenericConfigModel(doc interface{}) (*configModel, error) {
+	doc = normalizeGenericValue(doc)
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	model := new(configModel)
+	err = json.Unmarshal(data, model)
+	if err != nil {
+		return nil, err
+	}
+	err = setGenericUnknownAttrs(model, doc)
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// 与XML一样，无法识别的属性记录在unknownAttrs中，无法识别的元素（对象、数组）返回错误
+func setGenericUnknownAttrs(model *configModel, doc interface{}) (err error) {
+	if model.unknownAttrs, err = genericUnknownKeys(model, doc); err != nil {
+		return err
+	}
+	root, _ := doc.(map[string]interface{})
+	for i, item := range genericItems(root["formatters"]) {
+		if model.Formatters[i].unknownAttrs, err = genericUnknownKeys(model.Formatters[i], item); err != nil {
+			return err
+		}
+	}
+	for i, item := range genericItems(root["include"]) {
+		if model.Include[i].unknownAttrs, err = genericUnknownKeys(model.Include[i], item); err != nil {
+			return err
+		}
+	}
+	for i, item := range genericItems(root["exceptions"]) {
+		if model.Exceptions[i].unknownAttrs, err = genericUnknownKeys(model.Exceptions[i], item); err != nil {
+			return err
+		}
+	}
+	if err = setGenericRedactsUnknownAttrs(model.Redacts, root["redacts"]); err != nil {
+		return err
+	}
+	return setGenericOutputtersUnknownAttrs(model.Outputters, root["outputters"])
+}
+
+func setGenericOutputtersUnknownAttrs(models outputterModels, doc interface{}) (err error) {
+	for i, item := range genericItems(doc) {
+		//每一项都是以outputter类型为唯一键的对象
+		for _, value := range item.(map[string]interface{}) {
+			model := models[i]
+			if model.unknownAttrs, err = genericUnknownKeys(model, value); err != nil {
+				return err
+			}
+			attrs, _ := value.(map[string]interface{})
+			for j, filter := range genericItems(attrs["filters"]) {
+				if model.Filters[j].unknownAttrs, err = genericUnknownKeys(model.Filters[j], filter); err != nil {
+					return err
+				}
+			}
+			if err = setGenericRedactsUnknownAttrs(model.Redacts, attrs["redacts"]); err != nil {
+				return err
+			}
+			if err = setGenericOutputtersUnknownAttrs(model.Outputters, attrs["outputters"]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func setGenericRedactsUnknownAttrs(models []*redactModel, doc interface{}) (err error) {
+	for i, item := range genericItems(doc) {
+		if models[i].unknownAttrs, err = genericUnknownKeys(models[i], item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 数组中的各项，已由json.Unmarshal检查过类型
+func genericItems(doc interface{}) []interface{} {
+	items, _ := doc.([]interface{})
+	return items
+}
+
+// 返回doc中没有对应json tag的键
+func genericUnknownKeys(model interface{}, doc interface{}) (unknown []string, err error) {
+	attrs, _ := doc.(map[string]interface{})
+	modelType := reflect.TypeOf(model).Elem()
+	names := make(map[string]bool, modelType.NumField())
+	for i := 0; i < modelType.NumField(); i++ {
+		names[strings.Split(modelType.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	for name, value := range attrs {
+		if names[name] && name != "-" {
+			continue
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			//由decodeConfigModel加上句号和文件名
+			return nil, errors.New("there was a unallowed element " + name)
+		}
+		unknown = append(unknown, name)
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// yaml.v2解析得到的map键为interface{}，JSON只支持字符串键
+func normalizeGenericValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeGenericValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeGenericValue(item)
+		}
+		return v
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalizeGenericValue(item)
+		}
+		return items
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeGenericValue(item)
+		}
+		return v
+	}
+	return value
+}
+
+//==============================================================================
+
+// XML配置文件中的元素
+type xmlConfigElement struct {
+	name       string
+	attributes map[string]string
+	children   []*xmlConfigElement
+	line       int
+	column     int
+}
+
+func (elt *xmlConfigElement) position() configPosition {
+	return configPosition{line: elt.line, column: elt.column}
+}
+
+func (elt *xmlConfigElement) String() string {
+	return fmt.Sprintf("%s (line %d, column %d)", elt.name, elt.line, elt.column)
+}
+
+func parseXMLConfigElements(reader io.Reader) (root *xmlConfigElement, err error) {
+	decoder := xml.NewDecoder(reader)
+	stack := make([]*xmlConfigElement, 0)
+	for {
+		line, column := decoder.InputPos()
+		var token xml.Token
+		token, err = decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			elt := &xmlConfigElement{name: t.Name.Local, attributes: make(map[string]string),
+				line: line, column: column}
+			for _, attr := range t.Attr {
+				elt.attributes[attr.Name.Local] = attr.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, elt)
+			} else if root == nil {
+				root = elt
+			}
+			stack = append(stack, elt)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if root == nil {
+		return nil, errors.New("there was no element")
+	}
+	return root, nil
+}
+
+func decodeXMLConfigModel(reader io.Reader, source string) (model *configModel, err error) {
+	var rootNode *xmlConfigElement
+	rootNode, err = parseXMLConfigElements(reader)
+	if err != nil {
+		return nil, errors.New("config file err: " + err.Error() + ". at file " + source)
+	}
+	if rootNode.name != "vlog" || len(rootNode.children) == 0 {
+		return nil, errors.New("config file err: the root element is not vlog or vlog element has no child element. at file " + source)
+	}
+
+	model = new(configModel)
+	model.pos = rootNode.position()
+	model.unknownAttrs = setModelAttributes(model, rootNode.attributes)
+	for _, elt := range rootNode.children {
+		switch elt.name {
+		case "outputters":
+			if model.Outputters != nil {
+				return nil, errors.New("there must be only one outputters element.")
+			}
+			model.Outputters, err = newOutputterModelsByXMLElement(elt.children)
+			if err != nil {
+				return nil, err
+			}
+		case "formatters":
+			//可以有多个formatters元素，依次追加，重复的id由加载和Validate报告
+			if model.Formatters == nil {
+				model.Formatters = make([]*formatterModel, 0, len(elt.children))
+			}
+			for _, child := range elt.children {
+				if child.name != "formatter" {
+					return nil, errors.New("there was a unallowed element " + child.String() + ".")
+				}
+				formatter := new(formatterModel)
+				formatter.pos = child.position()
+				formatter.unknownAttrs = setModelAttributes(formatter, child.attributes)
+				model.Formatters = append(model.Formatters, formatter)
+			}
+		case "exception":
+			if len(elt.children) > 0 {
+				return nil, errors.New("there was a unallowed element " + elt.children[0].String() + ".")
+			}
+			exception := new(exceptionModel)
+			exception.pos = elt.position()
+			exception.unknownAttrs = setModelAttributes(exception, elt.attributes)
+			model.Exceptions = append(model.Exceptions, exception)
+		case "redact":
+			if len(elt.children) > 0 {
+				return nil, errors.New("there was a unallowed element " + elt.children[0].String() + ".")
+			}
+			model.Redacts = append(model.Redacts, newRedactModelByXMLElement(elt))
+		case "include":
+			if len(elt.children) > 0 {
+				return nil, errors.New("there was a unallowed element " + elt.children[0].String() + ".")
+			}
+			include := new(includeModel)
+			include.pos = elt.position()
+			include.unknownAttrs = setModelAttributes(include, elt.attributes)
+			model.Include = append(model.Include, include)
+		default:
+			return nil, errors.New("there was a unallowed element " + elt.String() + ".")
+		}
+	}
+	return model, nil
+}
+
+func newOutputterModelsByXMLElement(elements []*xmlConfigElement) (outputterModels, error) {
+	models := make(outputterModels, 0, len(elements))
+	for _, child := range elements {
+		model := new(outputterModel)
+		model.Type = child.name
+		model.pos = child.position()
+		model.unknownAttrs = setModelAttributes(model, child.attributes)
+		//任何outputter都可以有filter、redact子元素，failover还可以有outputter子元素
+		outputters := make([]*xmlConfigElement, 0)
+		for _, elt := range child.children {
+			if elt.name == "redact" && len(elt.children) == 0 {
+				model.Redacts = append(model.Redacts, newRedactModelByXMLElement(elt))
+				continue
+			}
+			if elt.name == "filter" && len(elt.children) == 0 {
+				filter := new(filterModel)
+				filter.pos = elt.position()
+				filter.unknownAttrs = setModelAttributes(filter, elt.attributes)
+				model.Filters = append(model.Filters, filter)
+				continue
+			}
+			if child.name != "failover" || elt.name == "filter" || elt.name == "redact" {
+				return nil, errors.New("there was a unallowed element " + elt.String() + ".")
+			}
+			outputters = append(outputters, elt)
+		}
+		if len(outputters) > 0 {
+			var err error
+			model.Outputters, err = newOutputterModelsByXMLElement(outputters)
+			if err != nil {
+				return nil, err
+			}
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+func newRedactModelByXMLElement(elt *xmlConfigElement) *redactModel {
+	redact := new(redactModel)
+	redact.pos = elt.position()
+	redact.unknownAttrs = setModelAttributes(redact, elt.attributes)
+	return redact
+}
+
+// 按json tag将XML属性赋值给model中对应的configValue字段，返回无对应字段的属性名
+func setModelAttributes(model interface{}, attributes map[string]string) (unknown []string) {
+	value := reflect.ValueOf(model).Elem()
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Type == reflect.TypeOf(configValue("")) && name != "" && name != "-" {
+			fields[name] = value.Field(i)
+		}
+	}
+	for name, attr := range attributes {
+		field, ok := fields[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		field.SetString(attr)
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,409 @@
+package vlog
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// A problem found in a configuration file by Validate.
+type ConfigProblem struct {
+	File    string
+	Line    int //行号从1开始，为零表示位置未知（XML以外的格式不记录位置）
+	Column  int
+	Warning bool //为true时配置仍可加载，但可能不是预期的效果
+	Message string
+}
+
+// Formats the problem as file:line:column: severity: message.
+func (problem ConfigProblem) String() string {
+	location := problem.File
+	if problem.Line > 0 {
+		location += ":" + strconv.Itoa(problem.Line) + ":" + strconv.Itoa(problem.Column)
+	}
+	severity := "error"
+	if problem.Warning {
+		severity = "warning"
+	}
+	return location + ": " + severity + ": " + problem.Message
+}
+
+// Checks the configuration file and returns all problems found in it,
+// the file is valid for InitLoggerWithFile if none of the problems is an error.
+// Unlike InitLoggerWithFile the VLOG_CONFIG environment variable is not used.
+func Validate(fileName string) []ConfigProblem {
+	validator := &configValidator{fileName: fileName}
+	file, err := os.OpenFile(fileName, os.O_RDONLY, defaultFilePermissions)
+	if err != nil {
+		validator.errorf(configPosition{}, "%v", err)
+		return validator.problems
+	}
+	defer file.Close()
+
+	model, err := decodeConfigModel(file, configFormatByFileName(fileName), fileName)
+	if err == nil {
+		model, err = includeConfigModels(model, fileName, nil)
+	}
+	if err != nil {
+		validator.errorf(configPosition{}, "%v", err)
+		return validator.problems
+	}
+	applyConfigEnv(model)
+	validator.validate(model)
+	return validator.problems
+}
+
+// 各类型outputter可以使用的属性
+var outputterAttributes = map[string][]string{
+	"console":  {"formatterid", "levels", "async", "queuesize", "overflow", "audit"},
+	"file":     {"formatterid", "levels", "filename", "maxsize", "async", "queuesize", "overflow", "audit", "buffersize", "flushinterval", "fsync", "reopenonmove", "symlink", "idletimeout", "lockfile", "filemode", "dirmode", "group", "integrity", "integritykey", "encrypt", "encryptkeyenv", "encryptkeyfile"},
+	"rulefile": {"formatterid", "levels", "filename", "maxsize", "async", "queuesize", "overflow", "audit", "buffersize", "flushinterval", "fsync", "reopenonmove", "symlink", "idletimeout", "lockfile", "filemode", "dirmode", "group", "integrity", "integritykey", "encrypt", "encryptkeyenv", "encryptkeyfile"},
+	"database": {"formatterid", "levels", "type", "connurl", "tablename", "idletimeout", "async", "queuesize", "overflow", "audit"},
+	"failover": {"levels", "retryinterval", "async", "queuesize", "overflow", "audit"},
+}
+
+// failover的子outputter由failover统一写入，这些属性不起作用
+var failoverChildIgnoredAttributes = []string{"queuesize", "overflow"}
+
+type configValidator struct {
+	fileName    string
+	problems    []ConfigProblem
+	formatters  map[string]bool //已定义的formatter id
+	usedFormats map[string]bool //被outputter引用的formatter id
+}
+
+func (validator *configValidator) errorf(pos configPosition, format string, params ...interface{}) {
+	validator.addProblem(pos, false, fmt.Sprintf(format, params...))
+}
+
+func (validator *configValidator) warnf(pos configPosition, format string, params ...interface{}) {
+	validator.addProblem(pos, true, fmt.Sprintf(format, params...))
+}
+
+func (validator *configValidator) addProblem(pos configPosition, isWarning bool, message string) {
+	//include的文件中的问题记录其所在文件
+	fileName := pos.file
+	if fileName == "" {
+		fileName = validator.fileName
+	}
+	validator.problems = append(validator.problems, ConfigProblem{fileName, pos.line, pos.column,
+		isWarning, message})
+}
+
+func (validator *configValidator) validate(model *configModel) {
+	for _, name := range model.unknownAttrs {
+		validator.warnf(model.pos, "unknown attribute %s on vlog.", name)
+	}
+	minLevel, maxLevel := lvLowest, lvHighest
+	isLevelValid := true
+	if model.MinLevel != "" {
+		minLevel, isLevelValid = levelByName(string(model.MinLevel))
+		if !isLevelValid {
+			validator.errorf(model.pos, "vlog's attribute minlevel value is llegal: %s.", model.MinLevel)
+		}
+	}
+	if model.MaxLevel != "" {
+		var ok bool
+		maxLevel, ok = levelByName(string(model.MaxLevel))
+		if !ok {
+			isLevelValid = false
+			validator.errorf(model.pos, "vlog's attribute maxlevel value is llegal: %s.", model.MaxLevel)
+		}
+	}
+	if isLevelValid && minLevel > maxLevel {
+		validator.errorf(model.pos, "vlog's attribute minlevel %s is greater than maxlevel %s.", minLevel, maxLevel)
+	}
+	if _, err := (filePermissions{}).overrideByAttrs("vlog", model.FileMode, model.DirMode, model.Group); err != nil {
+		validator.errorf(model.pos, "%v", err)
+	}
+
+	for _, exception := range model.Exceptions {
+		for _, name := range exception.unknownAttrs {
+			validator.warnf(exception.pos, "unknown attribute %s on exception.", name)
+		}
+		if _, err := newLevelExceptionByModel(exception); err != nil {
+			validator.errorf(exception.pos, "%v", err)
+		}
+	}
+
+	validator.validateRedacts(model.Redacts)
+
+	validator.validateFormatters(model)
+	validator.usedFormats = make(map[string]bool)
+	if model.Outputters == nil {
+		validator.errorf(model.pos, "there was no outputters element.")
+	} else if len(model.Outputters) == 0 {
+		validator.errorf(model.pos, "outputters element must have one child element at least.")
+	}
+	for _, outputter := range model.Outputters {
+		validator.validateOutputter(outputter, false)
+	}
+	for _, formatter := range model.Formatters {
+		id := string(formatter.ID)
+		//include的formatter库中通常有未使用的formatter，不提示
+		isIncluded := formatter.pos.file != "" && formatter.pos.file != validator.fileName
+		if id != "" && !validator.usedFormats[id] && !isIncluded {
+			validator.warnf(formatter.pos, "formatter %s is not used by any outputter.", id)
+			//同一id只提示一次
+			validator.usedFormats[id] = true
+		}
+	}
+}
+
+func (validator *configValidator) validateFormatters(model *configModel) {
+	validator.formatters = make(map[string]bool)
+	if model.Formatters == nil {
+		validator.errorf(model.pos, "there was no formatters element.")
+		return
+	}
+	if len(model.Formatters) == 0 {
+		validator.errorf(model.pos, "formatters element must have one child element at least named formatter.")
+	}
+	for _, formatter := range model.Formatters {
+		for _, name := range formatter.unknownAttrs {
+			validator.warnf(formatter.pos, "unknown attribute %s on formatter.", name)
+		}
+		id := string(formatter.ID)
+		if id == "" {
+			validator.errorf(formatter.pos, "formatter must have id attribute.")
+		} else if validator.formatters[id] {
+			validator.errorf(formatter.pos, "formatter id %s is duplicated.", id)
+		}
+		validator.formatters[id] = true
+		if formatter.Format == "" {
+			validator.errorf(formatter.pos, "formatter must have format attribute.")
+		} else if _, err := newFormatter(string(formatter.Format), nil); err != nil {
+			validator.errorf(formatter.pos, "formatter %s's format is illegal: %v", id, err)
+		}
+	}
+}
+
+func (validator *configValidator) validateOutputter(model *outputterModel, inFailover bool) {
+	allowed, ok := outputterAttributes[model.Type]
+	if !ok || (inFailover && model.Type == "failover") {
+		validator.errorf(model.pos, "there was a unallowed element %s.", model.Type)
+		return
+	}
+	for _, name := range model.unknownAttrs {
+		validator.warnf(model.pos, "unknown attribute %s on %s.", name, model.Type)
+	}
+	for _, name := range modelAttributeNames(model) {
+		if !containsString(allowed, name) {
+			validator.warnf(model.pos, "attribute %s is ignored by %s.", name, model.Type)
+		} else if inFailover && containsString(failoverChildIgnoredAttributes, name) {
+			validator.warnf(model.pos, "attribute %s is ignored by the outputters of failover.", name)
+		}
+	}
+
+	if _, err := parseAllowedLevelList(model); err != nil {
+		validator.errorf(model.pos, "%v", err)
+	}
+	validator.validateFilters(model)
+	validator.validateRedacts(model.Redacts)
+	isAudit, err := parseAuditAttr(model)
+	if err != nil {
+		validator.errorf(model.pos, "%v", err)
+	} else if isAudit && inFailover {
+		validator.errorf(model.pos, "%s in failover can not be audit.", model.Type)
+	} else if isAudit && (model.Levels != "" || len(model.Filters) > 0) {
+		validator.warnf(model.pos, "levels and filters are ignored by the audit outputter.")
+	}
+	if model.Async != "" && model.Async != "true" && model.Async != "false" {
+		validator.errorf(model.pos, "%s's attribute async value is illegal: %s.", model.Type, model.Async)
+	}
+	if model.Async == "true" && inFailover {
+		validator.errorf(model.pos, "%s in failover can not be async.", model.Type)
+	}
+	if model.Async == "true" && !inFailover {
+		//未开启异步时queuesize、overflow不被解析
+		if _, err := parseModelToQueueSize(model); err != nil {
+			validator.errorf(model.pos, "%v", err)
+		}
+		if _, err := newAsyncQueue(1, string(model.Overflow)); err != nil {
+			validator.errorf(model.pos, "%s's attribute %v", model.Type, err)
+		}
+	}
+
+	if model.Type == "failover" {
+		validator.validateFailover(model)
+		return
+	}
+	if _, err := parseModelToIdleTimeout(model); err != nil {
+		validator.errorf(model.pos, "%v", err)
+	}
+	if model.FormatterID == "" {
+		validator.errorf(model.pos, "%s must have formatterid attribute.", model.Type)
+	} else {
+		validator.usedFormats[string(model.FormatterID)] = true
+		if !validator.formatters[string(model.FormatterID)] {
+			validator.errorf(model.pos, "there was no formatter the id by %s.", model.FormatterID)
+		}
+	}
+
+	switch model.Type {
+	case "file", "rulefile":
+		if model.MaxSize != "" {
+			if _, err := parseSize(string(model.MaxSize)); err != nil {
+				validator.errorf(model.pos, "%s's attribute maxsize value is illegal: %v", model.Type, err)
+			}
+		}
+		if model.Integrity != "" {
+			if _, err := newHashChain(string(model.Integrity), []byte(model.IntegrityKey)); err != nil {
+				validator.errorf(model.pos, "%s's attribute %v", model.Type, err)
+			}
+		} else if model.IntegrityKey != "" {
+			validator.warnf(model.pos, "attribute integritykey is ignored without integrity.")
+		}
+		validator.validateEncrypt(model)
+		if _, err := (filePermissions{}).overrideByAttrs(model.Type, model.FileMode, model.DirMode, model.Group); err != nil {
+			validator.errorf(model.pos, "%v", err)
+		}
+		policy, err := parseModelToFlushPolicy(model)
+		if err != nil {
+			validator.errorf(model.pos, "%v", err)
+		}
+		switch model.LockFile {
+		case "", "false":
+		case "true":
+			if !isFlockSupported {
+				validator.errorf(model.pos, "%s's attribute lockfile is not supported on %s.", model.Type, runtime.GOOS)
+			}
+			if policy.bufferSize > 0 {
+				validator.errorf(model.pos, "%s's attribute lockfile can not be used with buffersize.", model.Type)
+			}
+			if model.Integrity != "" {
+				validator.errorf(model.pos, "%s's attribute lockfile can not be used with integrity.", model.Type)
+			}
+		default:
+			validator.errorf(model.pos, "%s's attribute lockfile value is illegal: %s.", model.Type, model.LockFile)
+		}
+		if model.Symlink != "" && model.Type == "rulefile" {
+			if _, err := newFormatter(string(model.Symlink), fileNameTags); err != nil {
+				validator.errorf(model.pos, "%s's attribute symlink value is illegal: %v", model.Type, err)
+			}
+		}
+		if model.ReopenOnMove != "" && model.ReopenOnMove != "true" && model.ReopenOnMove != "false" {
+			validator.errorf(model.pos, "%s's attribute reopenonmove value is illegal: %s.", model.Type, model.ReopenOnMove)
+		}
+		if model.FileName == "" {
+			validator.errorf(model.pos, "%s element has no filename attribute.", model.Type)
+			return
+		}
+		//只检查属性，不创建writer
+		if model.Type == "file" {
+			err = checkFileName(string(model.FileName))
+		} else {
+			_, err = newFormatter(string(model.FileName), fileNameTags)
+		}
+		if err != nil {
+			validator.errorf(model.pos, "%s's attribute filename value is illegal: %v", model.Type, err)
+		}
+	case "database":
+		if model.DBType == "" || model.ConnURL == "" || model.TableName == "" {
+			for i, value := range []configValue{model.DBType, model.ConnURL, model.TableName} {
+				if value == "" {
+					validator.errorf(model.pos, "%s must be have %s attribute.", model.Type,
+						[]string{"type", "connurl", "tablename"}[i])
+				}
+			}
+			return
+		}
+		if err := checkDBType(string(model.DBType)); err != nil {
+			validator.errorf(model.pos, "%v", err)
+		}
+	}
+}
+
+func (validator *configValidator) validateFilters(model *outputterModel) {
+	for _, filter := range model.Filters {
+		for _, name := range filter.unknownAttrs {
+			validator.warnf(filter.pos, "unknown attribute %s on filter.", name)
+		}
+		rule, err := parseModelToFilterRule(filter)
+		if err == nil {
+			_, err = newFilter(rule)
+		}
+		if err != nil {
+			validator.errorf(filter.pos, "%v", err)
+		}
+	}
+}
+
+func (validator *configValidator) validateEncrypt(model *outputterModel) {
+	if model.Encrypt == "" {
+		if model.EncryptKeyEnv != "" || model.EncryptKeyFile != "" {
+			validator.warnf(model.pos, "attributes encryptkeyenv and encryptkeyfile are ignored without encrypt.")
+		}
+		return
+	}
+	if model.Integrity != "" {
+		validator.errorf(model.pos, "%s's attribute integrity can not be used with encrypt.", model.Type)
+	}
+	if string(model.Encrypt) != EncryptAESGCM {
+		validator.errorf(model.pos, "%s's attribute encrypt value is illegal: %s, only %s is supported.",
+			model.Type, model.Encrypt, EncryptAESGCM)
+	}
+	if model.EncryptKeyEnv != "" && model.EncryptKeyFile == "" && os.Getenv(string(model.EncryptKeyEnv)) == "" {
+		//密钥通常只在部署环境中设置
+		validator.warnf(model.pos, "environment variable %s of encryptkeyenv is not set.", model.EncryptKeyEnv)
+		return
+	}
+	if _, err := loadEncryptKey(string(model.EncryptKeyEnv), string(model.EncryptKeyFile)); err != nil {
+		validator.errorf(model.pos, "%s's attribute %v", model.Type, err)
+	}
+}
+
+func (validator *configValidator) validateRedacts(redacts []*redactModel) {
+	for _, redact := range redacts {
+		for _, name := range redact.unknownAttrs {
+			validator.warnf(redact.pos, "unknown attribute %s on redact.", name)
+		}
+		if _, err := newRedactRule(parseModelToRedactRule(redact)); err != nil {
+			validator.errorf(redact.pos, "%v", err)
+		} else if redact.Key != "" && redact.Action != RedactHash {
+			validator.warnf(redact.pos, "attribute key is ignored without action=\"hash\".")
+		}
+	}
+}
+
+func (validator *configValidator) validateFailover(model *outputterModel) {
+	if model.RetryInterval != "" {
+		if _, err := parseDuration(string(model.RetryInterval)); err != nil {
+			validator.errorf(model.pos, "%s's attribute retryinterval value is illegal: %v", model.Type, err)
+		}
+	}
+	if len(model.Outputters) == 0 {
+		validator.errorf(model.pos, "failover element must have one child element at least.")
+	}
+	for _, child := range model.Outputters {
+		validator.validateOutputter(child, true)
+	}
+}
+
+// 返回model中已设置的属性名，按字段顺序
+func modelAttributeNames(model *outputterModel) (names []string) {
+	value := reflect.ValueOf(model).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Type != reflect.TypeOf(configValue("")) || name == "" || name == "-" {
+			continue
+		}
+		if value.Field(i).String() != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func containsString(list []string, str string) bool {
+	for _, v := range list {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
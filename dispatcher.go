@@ -2,10 +2,23 @@ package vlog
 
 import (
 	"errors"
+	"io"
+	"sync"
+	"time"
 )
 
 type dispatcher struct {
 	writers     []*formattedWriter
+	//审计outputter只由调用Audit的goroutine同步写入，与Flush互斥
+	auditLock   sync.Mutex
+	//创建时记录的全部outputter，GetStats、ReopenFiles可与Close并发读取
+	outputters  []outputterEntry
+}
+
+// 创建dispatcher时的outputter及其writer，formattedWriter.Close会将writer置为nil
+type outputterEntry struct {
+	*formattedWriter
+	writer io.WriteCloser
 }
 
 func createDispatcher(receivers []*formattedWriter) (*dispatcher, error) {
@@ -14,6 +27,14 @@ func createDispatcher(receivers []*formattedWriter) (*dispatcher, error) {
 	}
 	disp := new(dispatcher)
 	disp.writers = receivers
+	for _, writer := range receivers {
+		disp.outputters = append(disp.outputters, outputterEntry{writer, writer.writer})
+		if fw, ok := writer.writer.(*failoverWriter); ok {
+			for _, child := range fw.writers {
+				disp.outputters = append(disp.outputters, outputterEntry{child, child.writer})
+			}
+		}
+	}
 	return disp, nil
 }
 
@@ -21,13 +42,96 @@ func (disp *dispatcher) Dispatch(message string, level LogLevel,
 	context runtimeContextInterface, errorFunc func(err error)) {
 	
 	for _, writer := range disp.writers {
-		err := writer.Write(message, level, context)
-		if err != nil {
-			errorFunc(err)
+		if writer.isAudit {
+			continue
+		}
+		if writer.async != nil {
+			//filter在写入goroutine中检查
+			if writer.isAllowed(level) {
+				writer.async.push(logMessage{level: level, message: message, context: context})
+			}
+			continue
+		}
+		//不记录未写入的等级
+		if writer.isAllowed(level) {
+			writeAndRecord(writer, message, level, context)
+		}
+	}
+}
+
+// 写入一条消息，记录统计信息并报告错误
+func writeAndRecord(writer *formattedWriter, message string, level LogLevel, context runtimeContextInterface) {
+	start := time.Now()
+	err := writer.Write(message, level, context)
+	writer.stats.record(time.Since(start), err)
+	if err != nil {
+		errorFunc(WriterError{writer.writerType, writer.formatter.id, message, level, err})
+	}
+}
+
+// 带缓冲的writer实现此接口
+type flusher interface {
+	Flush() error
+}
+
+// 刷新所有outputter的缓冲，异步outputter写完队列中已有的消息后刷新，全部完成后关闭done
+func (disp *dispatcher) Flush(done chan struct{}) {
+	pending := make([]chan struct{}, 0)
+	for _, writer := range disp.writers {
+		if writer.async != nil {
+			asyncDone := make(chan struct{})
+			writer.async.push(logMessage{flushDone: asyncDone})
+			pending = append(pending, asyncDone)
+			continue
+		}
+		if writer.isAudit {
+			disp.auditLock.Lock()
+			flushAndRecord(writer)
+			disp.auditLock.Unlock()
+			continue
+		}
+		flushAndRecord(writer)
+	}
+	go func() {
+		for _, asyncDone := range pending {
+			<-asyncDone
 		}
+		close(done)
+	}()
+}
+
+func flushAndRecord(writer *formattedWriter) {
+	err := writer.Flush()
+	if err != nil {
+		errorFunc(WriterError{writer.writerType, writer.formatter.id, "", 0, err})
 	}
 }
 
+// 异步队列中尚未写完的消息数，包括正在写入的消息
+func (disp *dispatcher) queuedCount() int {
+	count := 0
+	for _, writer := range disp.writers {
+		if writer.async != nil {
+			count += writer.async.pending()
+		}
+	}
+	return count
+}
+
+// 丢弃异步队列中剩余的消息
+func (disp *dispatcher) abandon() {
+	for _, writer := range disp.writers {
+		if writer.async != nil {
+			writer.async.abandon()
+		}
+	}
+}
+
+// 返回所有outputter，包括failover中的子outputter
+func (disp *dispatcher) allWriters() []outputterEntry {
+	return disp.outputters
+}
+
 func (disp *dispatcher) Close() error {
 	errMsg := ""
 	for _, fmtWriter := range disp.writers {
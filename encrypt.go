@@ -0,0 +1,246 @@
+package vlog
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The encrypt attribute value of file and rulefile elements: every write is
+// sealed by AES-GCM into a frame with its own random nonce, so appending after
+// a restart or a frame torn by a crash does not affect the other frames.
+// DecryptLog and the vlogcat command read such files.
+const EncryptAESGCM = "aes-gcm"
+
+// 帧格式：magic(4) | 版本(1) | 密文长度(4，大端) | nonce(12) | 密文（含16字节认证标签），
+// 前9字节作为附加认证数据，损坏的帧之后可从下一个magic继续读取
+const (
+	encryptFrameMagic   = "VLGE"
+	encryptFrameVersion = 1
+	encryptHeaderSize   = 9
+	encryptNonceSize    = 12
+	encryptMaxFrameSize = 64 * 1024 * 1024
+	encryptReadSize     = 32 * 1024
+)
+
+func newEncryptCipher(algorithm string, key []byte) (cipher.AEAD, error) {
+	if algorithm != EncryptAESGCM {
+		return nil, errors.New("encrypt value is illegal: " + algorithm + ", only " + EncryptAESGCM + " is supported.")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("encrypt key is illegal: " + err.Error())
+	}
+	return cipher.NewGCMWithNonceSize(block, encryptNonceSize)
+}
+
+// Parses an AES key of 16, 24 or 32 bytes encoded by hex or base64,
+// the format of the key file and the environment variable of encrypt.
+func ParseEncryptKey(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if key, err := hex.DecodeString(text); err == nil && isAESKeySize(len(key)) {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && isAESKeySize(len(key)) {
+		return key, nil
+	}
+	return nil, errors.New("encrypt key must be 16, 24 or 32 bytes encoded by hex or base64.")
+}
+
+func isAESKeySize(size int) bool {
+	return size == 16 || size == 24 || size == 32
+}
+
+// 读取encryptkeyenv或encryptkeyfile指定的密钥
+func loadEncryptKey(keyEnv, keyFile string) ([]byte, error) {
+	if keyEnv != "" && keyFile != "" {
+		return nil, errors.New("only one of encryptkeyenv and encryptkeyfile can be set.")
+	}
+	if keyEnv != "" {
+		text := os.Getenv(keyEnv)
+		if text == "" {
+			return nil, errors.New("environment variable " + keyEnv + " of encryptkeyenv is not set.")
+		}
+		return ParseEncryptKey(text)
+	}
+	if keyFile != "" {
+		content, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return ParseEncryptKey(string(content))
+	}
+	return nil, errors.New("encrypt needs encryptkeyenv or encryptkeyfile attribute.")
+}
+
+// 为file或rulefile outputter启用加密，algorithm为空时不启用
+func enableEncryption(name string, writer *formattedWriter, algorithm string, key []byte) error {
+	if algorithm == "" {
+		return nil
+	}
+	aead, err := newEncryptCipher(algorithm, key)
+	if err != nil {
+		return errors.New(name + "'s attribute " + err.Error())
+	}
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		if w.chain != nil {
+			return errors.New(name + "'s attribute integrity can not be used with encrypt.")
+		}
+		w.aead = aead
+	case *ruleFileWriter:
+		if w.integrity != "" {
+			return errors.New(name + "'s attribute integrity can not be used with encrypt.")
+		}
+		w.aead = aead
+	default:
+		return errors.New(name + " does not support the encrypt attribute.")
+	}
+	return nil
+}
+
+// 加密写入日志文件，每次Write写入一帧
+type encryptedWriter struct {
+	file *os.File
+	aead cipher.AEAD
+	size *int64 //fileWriter.currentFileSize，调用者已累加明文的字节数，此处累加帧头和认证标签
+}
+
+func (writer *encryptedWriter) Write(p []byte) (n int, err error) {
+	frame := make([]byte, encryptHeaderSize+encryptNonceSize,
+		encryptHeaderSize+encryptNonceSize+len(p)+writer.aead.Overhead())
+	copy(frame, encryptFrameMagic)
+	frame[4] = encryptFrameVersion
+	binary.BigEndian.PutUint32(frame[5:encryptHeaderSize], uint32(len(p)+writer.aead.Overhead()))
+	nonce := frame[encryptHeaderSize:]
+	if _, err = rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	frame = writer.aead.Seal(frame, nonce, p, frame[:encryptHeaderSize])
+	//一次写入整帧，O_APPEND保证帧不被其他写入打断
+	_, err = writer.file.Write(frame)
+	if err != nil {
+		return 0, err
+	}
+	*writer.size += int64(len(frame) - len(p))
+	return len(p), nil
+}
+
+func (writer *encryptedWriter) Sync() error {
+	return writer.file.Sync()
+}
+
+func (writer *encryptedWriter) Close() error {
+	return writer.file.Close()
+}
+
+// Decrypts a file written with encrypt="aes-gcm" to dst. Damaged data, like a
+// frame torn by a crash or modified bytes, is skipped and counted in skipped,
+// the frames after it are still decrypted. src is read frame by frame.
+func DecryptLog(dst io.Writer, src io.Reader, key []byte) (skipped int64, err error) {
+	aead, err := newEncryptCipher(EncryptAESGCM, key)
+	if err != nil {
+		return 0, err
+	}
+	reader := &frameReader{src: src}
+	for {
+		if err = reader.fill(encryptHeaderSize + encryptNonceSize); err != nil {
+			return skipped, err
+		}
+		data := reader.bytes()
+		if len(data) == 0 {
+			return skipped, nil
+		}
+		if size := frameSize(data); size > 0 {
+			if err = reader.fill(size); err != nil {
+				return skipped, err
+			}
+			data = reader.bytes()
+			if size <= len(data) {
+				if plain, ok := openFrame(aead, data[:size]); ok {
+					if _, err = dst.Write(plain); err != nil {
+						return skipped, err
+					}
+					reader.pos += size
+					continue
+				}
+			}
+		}
+		//从下一个magic继续
+		n := bytes.Index(data[1:], []byte(encryptFrameMagic)) + 1
+		if n == 0 {
+			n = len(data)
+			if !reader.isEOF {
+				//末尾可能是下一个magic的一部分
+				n -= len(encryptFrameMagic) - 1
+			}
+		}
+		skipped += int64(n)
+		reader.pos += n
+	}
+}
+
+// 按帧读取加密的日志文件，缓冲区中只保留未处理的数据
+type frameReader struct {
+	src   io.Reader
+	buf   []byte
+	pos   int //buf[pos:]为未处理的数据
+	isEOF bool
+}
+
+func (reader *frameReader) bytes() []byte {
+	return reader.buf[reader.pos:]
+}
+
+// 读取到未处理的数据至少有n字节，或已读完
+func (reader *frameReader) fill(n int) error {
+	for len(reader.buf)-reader.pos < n && !reader.isEOF {
+		if reader.pos > 0 {
+			//移走已处理的数据
+			reader.buf = reader.buf[:copy(reader.buf, reader.buf[reader.pos:])]
+			reader.pos = 0
+		}
+		if cap(reader.buf)-len(reader.buf) < encryptReadSize {
+			buf := make([]byte, len(reader.buf), 2*cap(reader.buf)+encryptReadSize)
+			copy(buf, reader.buf)
+			reader.buf = buf
+		}
+		m, err := reader.src.Read(reader.buf[len(reader.buf):cap(reader.buf)])
+		reader.buf = reader.buf[:len(reader.buf)+m]
+		if err == io.EOF {
+			reader.isEOF = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 返回data开头一帧的长度，帧头无效时为0
+func frameSize(data []byte) int {
+	if len(data) < encryptHeaderSize+encryptNonceSize || string(data[:4]) != encryptFrameMagic ||
+		data[4] != encryptFrameVersion {
+		return 0
+	}
+	length := int(binary.BigEndian.Uint32(data[5:encryptHeaderSize]))
+	if length > encryptMaxFrameSize {
+		return 0
+	}
+	return encryptHeaderSize + encryptNonceSize + length
+}
+
+// 解密一帧，认证失败时ok为false
+func openFrame(aead cipher.AEAD, frame []byte) (plain []byte, ok bool) {
+	nonce := frame[encryptHeaderSize : encryptHeaderSize+encryptNonceSize]
+	plain, err := aead.Open(nil, nonce, frame[encryptHeaderSize+encryptNonceSize:], frame[:encryptHeaderSize])
+	return plain, err == nil
+}
@@ -0,0 +1,121 @@
+package vlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default limits of the default error handler: at most defaultErrorBurst errors
+// of the same outputter are printed per defaultErrorInterval, the rest are counted
+// and reported as suppressed.
+const (
+	defaultErrorBurst    = 10
+	defaultErrorInterval = time.Minute
+)
+
+// Describes an error occurred in the logging pipeline.
+// OutputterType and FormatterID are empty if the error was not caused by an outputter.
+type WriterError struct {
+	OutputterType string   //出错的outputter类型，对应配置文件中的元素名
+	FormatterID   string   //出错的outputter使用的formatter id
+	Message       string   //未能写入的原始日志消息
+	Level         LogLevel //未能写入的日志等级
+	Err           error    //底层错误
+}
+
+func (we WriterError) Error() string {
+	if we.OutputterType == "" {
+		return we.Err.Error()
+	}
+	return we.OutputterType + "(formatter " + we.FormatterID + ") write error: " + we.Err.Error()
+}
+
+func (we WriterError) Unwrap() error {
+	return we.Err
+}
+
+var errorHandlerLock sync.RWMutex
+var errorHandler func(WriterError) = defaultErrorHandler
+var defaultErrorLimiter = newErrorRateLimiter(defaultErrorBurst, defaultErrorInterval)
+
+// Sets the function called for every error in the logging pipeline.
+// The handler is called from the dispatcher goroutine and must not block or log through vlog.
+// nil restores the default handler, which prints rate limited errors to stdout.
+func SetErrorHandler(handler func(WriterError)) {
+	errorHandlerLock.Lock()
+	defer errorHandlerLock.Unlock()
+	if handler == nil {
+		handler = defaultErrorHandler
+	}
+	errorHandler = handler
+}
+
+func errorFunc(err error) {
+	vlogStats.errors.Add(1)
+	we, ok := err.(WriterError)
+	if !ok {
+		we = WriterError{Err: err}
+	}
+	errorHandlerLock.RLock()
+	handler := errorHandler
+	errorHandlerLock.RUnlock()
+	handler(we)
+}
+
+func defaultErrorHandler(we WriterError) {
+	suppressed, ok := defaultErrorLimiter.allow(we.OutputterType + "\x00" + we.FormatterID)
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		fmt.Println("vlog error:", suppressed, "similar errors suppressed")
+	}
+	fmt.Println("vlog error:", we.Error())
+}
+
+// 按key限制一段时间内允许的错误数
+type errorRateLimiter struct {
+	lock     sync.Mutex
+	burst    int
+	interval time.Duration
+	windows  map[string]*errorWindow
+}
+
+type errorWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+func newErrorRateLimiter(burst int, interval time.Duration) *errorRateLimiter {
+	limiter := new(errorRateLimiter)
+	limiter.burst = burst
+	limiter.interval = interval
+	limiter.windows = make(map[string]*errorWindow)
+	return limiter
+}
+
+// 返回是否允许输出，以及上一个时间段内被抑制的错误数
+func (limiter *errorRateLimiter) allow(key string) (suppressed int, ok bool) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	now := time.Now()
+	window, exists := limiter.windows[key]
+	if !exists {
+		window = &errorWindow{start: now}
+		limiter.windows[key] = window
+	}
+	if now.Sub(window.start) >= limiter.interval {
+		suppressed = window.suppressed
+		window.start = now
+		window.count = 0
+		window.suppressed = 0
+	}
+	if window.count >= limiter.burst {
+		window.suppressed++
+		return 0, false
+	}
+	window.count++
+	return suppressed, true
+}
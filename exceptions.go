@@ -0,0 +1,100 @@
+package vlog
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+)
+
+// 对匹配的调用者使用不同于vlog元素minlevel、maxlevel的等级范围，
+// funcpattern与调用者函数名（含包路径）匹配，filepattern与调用者文件的相对路径或绝对路径匹配，
+// 模式中“*”匹配任意字符（含“/”），“?”匹配一个字符，未设置的模式匹配全部调用者
+type levelException struct {
+	funcPattern *regexp.Regexp
+	filePattern *regexp.Regexp
+	minLevel    LogLevel
+	maxLevel    LogLevel
+}
+
+func newLevelException(funcPattern, filePattern string, minLevel, maxLevel LogLevel) (*levelException, error) {
+	if funcPattern == "" && filePattern == "" {
+		return nil, errors.New("exception must have funcpattern or filepattern attribute.")
+	}
+	if minLevel > maxLevel {
+		return nil, errors.New("exception's attribute minlevel " + minLevel.String() +
+			" is greater than maxlevel " + maxLevel.String() + ".")
+	}
+	exception := new(levelException)
+	exception.funcPattern = compileFilterPattern(funcPattern)
+	exception.filePattern = compileFilterPattern(filePattern)
+	exception.minLevel = minLevel
+	exception.maxLevel = maxLevel
+	return exception, nil
+}
+
+func (exception *levelException) matches(context runtimeContextInterface) bool {
+	if exception.funcPattern != nil && !exception.funcPattern.MatchString(context.Func()) {
+		return false
+	}
+	if exception.filePattern != nil && !exception.filePattern.MatchString(context.ShortPath()) &&
+		!exception.filePattern.MatchString(context.FullPath()) {
+		return false
+	}
+	return true
+}
+
+// 调用日志记录的位置
+type callSite struct {
+	file string
+	line int
+}
+
+// 按调用位置缓存匹配的exception，同一位置的调用者不变，不必每次匹配模式
+type exceptionCache struct {
+	lock       sync.RWMutex
+	exceptions map[callSite]*levelException //值为nil表示没有匹配的exception
+}
+
+// 返回第一个与调用者匹配的exception，没有时返回nil
+func (log *logger) findException(context runtimeContextInterface) *levelException {
+	if len(log.exceptions) == 0 || !context.IsValid() {
+		return nil
+	}
+	site := callSite{context.FullPath(), context.Line()}
+	cache := &log.exceptionCache
+	cache.lock.RLock()
+	exception, ok := cache.exceptions[site]
+	cache.lock.RUnlock()
+	if ok {
+		return exception
+	}
+
+	for _, e := range log.exceptions {
+		if e.matches(context) {
+			exception = e
+			break
+		}
+	}
+	cache.lock.Lock()
+	if cache.exceptions == nil {
+		cache.exceptions = make(map[callSite]*levelException)
+	}
+	cache.exceptions[site] = exception
+	cache.lock.Unlock()
+	return exception
+}
+
+// 检查消息等级是否在调用者适用的等级范围内
+func (log *logger) isLevelAllowed(level LogLevel, context runtimeContextInterface) bool {
+	if level == LvImportant {
+		//与严重程度无关
+		return true
+	}
+	minLevel, maxLevel := log.minLevel, log.maxLevel
+	if context != nil {
+		if exception := log.findException(context); exception != nil {
+			minLevel, maxLevel = exception.minLevel, exception.maxLevel
+		}
+	}
+	return level >= minLevel && level <= maxLevel
+}
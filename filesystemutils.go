@@ -11,10 +11,10 @@ import (
 	"sync"
 )
 
-// File and directory permitions.
+// File and directory permitions, the umask of the process is applied when creating.
 const (
 	defaultFilePermissions      = 0666
-	defaultDirectoryPermissions = 0767
+	defaultDirectoryPermissions = 0777
 )
 
 const (
@@ -0,0 +1,183 @@
+package vlog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A log message as seen by the filters registered by RegisterFilter.
+type Record struct {
+	Level   LogLevel
+	Message string
+	Time    time.Time
+	File    string //调用日志记录的文件（含绝对路径）
+	Package string //调用日志记录的包路径
+	Func    string //调用日志记录的函数名（含包路径）
+	Line    int
+	Fields  Fields
+}
+
+func newRecord(message string, level LogLevel, context runtimeContextInterface) *Record {
+	record := &Record{Level: level, Message: message, Time: context.CallTime(), Fields: context.Fields()}
+	if context.IsValid() {
+		record.File = context.FullPath()
+		record.Func = context.Func()
+		record.Package = packageOfFunc(record.Func)
+		record.Line = context.Line()
+	}
+	return record
+}
+
+// github.com/a/b.(*T).Method的包路径为github.com/a/b
+func packageOfFunc(funcName string) string {
+	lastSlash := strings.LastIndex(funcName, "/")
+	if i := strings.Index(funcName[lastSlash+1:], "."); i >= 0 {
+		return funcName[:lastSlash+1+i]
+	}
+	return funcName
+}
+
+// A filter of an outputter, the conditions that are set must all match.
+// File, Package and Func are patterns in which "*" matches any characters
+// (including "/") and "?" matches one character.
+//
+// A message is written by the outputter only if every filter of it accepts
+// the message: an include filter accepts the matched messages, an exclude
+// filter (Exclude is true) accepts the others.
+type FilterRule struct {
+	Exclude bool
+	Levels  []LogLevel //仅对这些等级的消息生效，nil表示全部等级
+	Message string     //消息内容的正则表达式
+	File    string     //调用者文件（含绝对路径）
+	Package string     //调用者的包路径
+	Func    string     //调用者的函数名（含包路径）
+	Field   string     //name=pattern，与fmt.Sprint(字段值)匹配，字段不存在时不匹配
+	Custom  string     //RegisterFilter注册的过滤器名
+}
+
+var customFilters = make(map[string]func(Record) bool)
+var customFiltersLock sync.RWMutex
+
+// Registers a filter used by the custom attribute of filter element, or by
+// FilterRule.Custom. It must be called before the configuration is loaded.
+// The filter returns true for the messages it matches.
+func RegisterFilter(name string, filter func(Record) bool) {
+	customFiltersLock.Lock()
+	defer customFiltersLock.Unlock()
+	if filter == nil {
+		delete(customFilters, name)
+		return
+	}
+	customFilters[name] = filter
+}
+
+type filter struct {
+	exclude    bool
+	levels     map[LogLevel]bool
+	message    *regexp.Regexp
+	file       *regexp.Regexp
+	pkg        *regexp.Regexp
+	funcName   *regexp.Regexp
+	fieldName  string
+	fieldValue *regexp.Regexp
+	custom     func(Record) bool
+}
+
+func newFilter(rule FilterRule) (f *filter, err error) {
+	f = new(filter)
+	f.exclude = rule.Exclude
+	if rule.Levels != nil {
+		f.levels = newAllowedLevelList(rule.Levels)
+	}
+	if rule.Message != "" {
+		f.message, err = regexp.Compile(rule.Message)
+		if err != nil {
+			return nil, errors.New("filter's attribute message value is illegal: " + err.Error())
+		}
+	}
+	f.file = compileFilterPattern(rule.File)
+	f.pkg = compileFilterPattern(rule.Package)
+	f.funcName = compileFilterPattern(rule.Func)
+	if rule.Field != "" {
+		i := strings.Index(rule.Field, "=")
+		if i <= 0 {
+			return nil, errors.New("filter's attribute field value is illegal: " + rule.Field + ", it must be name=pattern.")
+		}
+		f.fieldName = rule.Field[:i]
+		f.fieldValue = compileFilterPattern(rule.Field[i+1:])
+		if f.fieldValue == nil {
+			//name=表示字段值为空
+			f.fieldValue = regexp.MustCompile("^$")
+		}
+	}
+	if rule.Custom != "" {
+		customFiltersLock.RLock()
+		f.custom = customFilters[rule.Custom]
+		customFiltersLock.RUnlock()
+		if f.custom == nil {
+			return nil, errors.New("there was no filter registered by name " + rule.Custom + ".")
+		}
+	}
+	return f, nil
+}
+
+func newFilters(rules []FilterRule) (filters []*filter, err error) {
+	for _, rule := range rules {
+		var f *filter
+		f, err = newFilter(rule)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// 将含"*"、"?"的模式转换为正则表达式，pattern为空时返回nil
+func compileFilterPattern(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// 是否允许写入此消息
+func (f *filter) accept(record *Record) bool {
+	if f.levels != nil && !f.levels[record.Level] {
+		//对此等级不生效
+		return true
+	}
+	return f.matches(record) != f.exclude
+}
+
+func (f *filter) matches(record *Record) bool {
+	if f.message != nil && !f.message.MatchString(record.Message) {
+		return false
+	}
+	if f.file != nil && !f.file.MatchString(record.File) {
+		return false
+	}
+	if f.pkg != nil && !f.pkg.MatchString(record.Package) {
+		return false
+	}
+	if f.funcName != nil && !f.funcName.MatchString(record.Func) {
+		return false
+	}
+	if f.fieldValue != nil {
+		value, ok := record.Fields[f.fieldName]
+		if !ok || !f.fieldValue.MatchString(fmt.Sprint(value)) {
+			return false
+		}
+	}
+	if f.custom != nil && !f.custom(*record) {
+		return false
+	}
+	return true
+}
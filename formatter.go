@@ -1,8 +1,12 @@
 package vlog
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"os"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +31,13 @@ const (
 
 var DefaultMsgFormat = "%ns [%level] %msg%n"
 
+// Number of frames captured by %stack when no depth is given.
+const DefaultStackDepth = 32
+
+const stackTag = "stack"
+
+var processID = strconv.Itoa(os.Getpid())
+
 var defaultFormatter *formatter
 var msgOnlyFormatter *formatter
 
@@ -59,14 +70,20 @@ var tagFuncs = map[string]tagFunc{
 	"ns":      tagNs,
 	"n":       tagN,
 	"t":       tagT,
+	"err":     tagErr,
+	"fields":  tagFields,
+	"pid":     tagPid,
 }
 
 var tagWithParamFuncCreator = map[string]tagFuncCreator{
-	"date": createDateTimeTagFunc,
-	"escm": createANSIEscapeFunc,
+	"date":   createDateTimeTagFunc,
+	"escm":   createANSIEscapeFunc,
+	stackTag: createStackTagFunc,
 }
 
 type formatter struct {
+	//配置文件中的formatter id
+	id string
 	//带标签的格式化字符串
 	fmtStringOriginal string
 	fmtString         string
@@ -74,6 +91,8 @@ type formatter struct {
 	allowedTags []string
 	//标签处理函数
 	tagFuncs    []tagFunc
+	//%stack需要的调用栈层数，为零表示不需要获取调用栈
+	stackDepth int
 }
 
 // NewFormatter参数：
@@ -207,6 +226,9 @@ func (formatter *formatter) findTagFuncParametrized(letters string, lettersStart
 				}
 			}
 
+			if currentTag == stackTag {
+				formatter.requireStack(parseStackDepth(paramter))
+			}
 			return functionCreator(paramter), len(currentTag) + parameterLen, true
 		}
 
@@ -244,6 +266,12 @@ func (formatter *formatter) Format(message string, level LogLevel, context runti
 	return fmt.Sprintf(formatter.fmtString, params...)
 }
 
+func (formatter *formatter) requireStack(depth int) {
+	if depth > formatter.stackDepth {
+		formatter.stackDepth = depth
+	}
+}
+
 func (formatter *formatter) String() string {
 	return formatter.fmtStringOriginal
 }
@@ -258,8 +286,8 @@ const (
 
 //%level
 func tagLevel(message string, level LogLevel, context runtimeContextInterface) interface{} {
-	levelStr, ok := lv2StringMap[level]
-	if !ok {
+	levelStr := level.String()
+	if levelStr == "" {
 		return wrongLogLevel
 	}
 	return levelStr
@@ -272,8 +300,8 @@ func tagLv(message string, level LogLevel, context runtimeContextInterface) inte
 
 //%LV
 func tagLV(message string, level LogLevel, context runtimeContextInterface) interface{} {
-	levelStr, ok := lv2StrMap[level]
-	if !ok {
+	levelStr := level.ShortString()
+	if levelStr == "" {
 		return wrongLogLevel
 	}
 	return levelStr
@@ -326,11 +354,93 @@ func tagN(message string, level LogLevel, context runtimeContextInterface) inter
 	return "\n"
 }
 
+//%pid，多个进程使用同一配置文件时可用于区分日志文件
+func tagPid(message string, level LogLevel, context runtimeContextInterface) interface{} {
+	return processID
+}
+
 //%t
 func tagT(message string, level LogLevel, context runtimeContextInterface) interface{} {
 	return "\t"
 }
 
+//%fields，按字段名排序：name=value name=value
+func tagFields(message string, level LogLevel, context runtimeContextInterface) interface{} {
+	fields := context.Fields()
+	if len(fields) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := bytes.NewBufferString("")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(buf, "%s=%v", name, fields[name])
+	}
+	return buf.String()
+}
+
+//%err
+//输出日志参数中的error，包括errors.Unwrap得到的整个错误链以及错误自带的调用栈
+func tagErr(message string, level LogLevel, context runtimeContextInterface) interface{} {
+	err := context.Err()
+	if err == nil {
+		return ""
+	}
+	buf := bytes.NewBufferString("")
+	for i := 0; err != nil; i++ {
+		if i == 0 {
+			buf.WriteString("error: ")
+		} else {
+			buf.WriteString("caused by: ")
+		}
+		buf.WriteString(err.Error())
+		buf.WriteString("\n")
+		if stack := errorStackTrace(err); stack != "" {
+			buf.WriteString(stack)
+			buf.WriteString("\n")
+		}
+		err = errors.Unwrap(err)
+	}
+	return buf.String()
+}
+
+// Returns the stack attached to the error by a StackTrace() method
+// (github.com/pkg/errors and compatible packages), empty if there is none.
+func errorStackTrace(err error) string {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return ""
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%+v", method.Call(nil)[0].Interface()), "\n")
+}
+
+//%stack(depth)
+func createStackTagFunc(depthString string) tagFunc {
+	depth := parseStackDepth(depthString)
+	return func(message string, level LogLevel, context runtimeContextInterface) interface{} {
+		//每层调用栈占两行
+		lines := strings.SplitAfter(context.Stack(), "\n")
+		if len(lines) > depth*2 {
+			lines = lines[:depth*2]
+		}
+		return strings.Join(lines, "")
+	}
+}
+
+func parseStackDepth(depthString string) int {
+	depth, err := strconv.Atoi(depthString)
+	if err != nil || depth <= 0 {
+		return DefaultStackDepth
+	}
+	return depth
+}
+
 //%date("format pattern")
 func createDateTimeTagFunc(dateTimeFormat string) tagFunc {
 	format := dateTimeFormat
@@ -0,0 +1,406 @@
+package vlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The integrity attribute value of file and rulefile elements: every record is
+// written as "<length>:<record>\tchain=<hex>\n", where length is the byte length
+// of the record without its trailing newline, kept byte for byte, and hex is the
+// SHA-256 of the previous record's chain value and the record. A checkpoint line
+// signed by HMAC-SHA256 is written when the file is rotated or closed.
+// VerifyIntegrity checks such files.
+const IntegritySHA256Chain = "sha256-chain"
+
+const (
+	chainSeparator   = "\tchain="
+	checkpointPrefix = "#vlog-checkpoint "
+	//长度前缀的最大位数和记录的最大长度
+	chainLengthDigits  = 10
+	maxChainRecordSize = 64 * 1024 * 1024
+)
+
+var (
+	errChainTruncated = errors.New("record has no chain hash, the file was truncated or modified")
+	errChainMalformed = errors.New("record does not match its length prefix, the file was modified")
+)
+
+// 日志文件的哈希链，链在文件轮转后延续到下一个文件
+type hashChain struct {
+	key       []byte //checkpoint的HMAC密钥
+	prev      []byte //上一条记录的哈希，第一条记录之前为全零
+	isResumed bool   //是否已从已有的日志文件中恢复prev
+	isDirty   bool   //上一个checkpoint之后是否写入了记录
+}
+
+func newHashChain(algorithm string, key []byte) (*hashChain, error) {
+	if algorithm != IntegritySHA256Chain {
+		return nil, errors.New("integrity value is illegal: " + algorithm + ", only " + IntegritySHA256Chain + " is supported.")
+	}
+	if len(key) == 0 {
+		return nil, errors.New("integritykey can not be empty, it signs the checkpoints.")
+	}
+	chain := new(hashChain)
+	chain.key = key
+	chain.prev = make([]byte, sha256.Size)
+	return chain, nil
+}
+
+// 为file或rulefile outputter启用integrity，algorithm为空时不启用
+func enableIntegrity(name string, writer *formattedWriter, algorithm string, key []byte) error {
+	if algorithm == "" {
+		return nil
+	}
+	chain, err := newHashChain(algorithm, key)
+	if err != nil {
+		return errors.New(name + "'s attribute " + err.Error())
+	}
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		w.chain = chain
+	case *ruleFileWriter:
+		//每个文件各自一条链
+		w.integrity, w.integrityKey = algorithm, key
+	default:
+		return errors.New(name + " does not support the integrity attribute.")
+	}
+	return nil
+}
+
+func chainHash(prev []byte, content string) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	h.Write([]byte(content))
+	return h.Sum(nil)
+}
+
+// 在record前加长度前缀、末尾追加链式哈希，写入成功后须调用commit。
+// 记录按长度读取，其内容中的chain=或checkpoint前缀不会被当作链的数据
+func (chain *hashChain) seal(record []byte) (line []byte, hash []byte) {
+	content := strings.TrimSuffix(string(record), "\n")
+	hash = chainHash(chain.prev, content)
+	return []byte(strconv.Itoa(len(content)) + ":" + content + chainSeparator + hex.EncodeToString(hash) + "\n"), hash
+}
+
+// 链中是否已有记录，新文件开头须先写入checkpoint，之前的文件被删除后仍可从此校验
+func (chain *hashChain) isStarted() bool {
+	return !bytes.Equal(chain.prev, make([]byte, sha256.Size))
+}
+
+func (chain *hashChain) commit(hash []byte) {
+	chain.prev = hash
+	chain.isDirty = true
+}
+
+// 签名当前的链式哈希
+func (chain *hashChain) checkpoint(now time.Time) []byte {
+	signed := "time=" + now.UTC().Format(time.RFC3339Nano) + " chain=" + hex.EncodeToString(chain.prev)
+	return []byte(checkpointPrefix + signed + " hmac=" + checkpointMAC(chain.key, signed) + "\n")
+}
+
+func checkpointMAC(key []byte, signed string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 从第一个含有记录的文件中恢复最后的链式哈希，进程重启后链得以延续
+func (chain *hashChain) resume(fileNames ...string) error {
+	chain.isResumed = true
+	for _, fileName := range fileNames {
+		file, err := os.Open(fileName)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var last, hash []byte
+		var checkpoint string
+		reader := newChainReader(file)
+		for {
+			_, hash, checkpoint, err = reader.next()
+			if err == io.EOF || err == errChainTruncated || err == errChainMalformed {
+				//文件末尾不完整的记录（如进程崩溃时）不影响之前的记录
+				err = nil
+				break
+			}
+			if err != nil {
+				break
+			}
+			if checkpoint == "" {
+				last = hash
+			}
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			chain.prev = last
+			return nil
+		}
+	}
+	return nil
+}
+
+// 按长度前缀依次读取日志文件中的记录和checkpoint，不按换行符拆分记录
+type chainReader struct {
+	reader     *bufio.Reader
+	lineNumber int //下一条记录或checkpoint的行号
+}
+
+func newChainReader(file io.Reader) *chainReader {
+	return &chainReader{reader: bufio.NewReader(file), lineNumber: 1}
+}
+
+// 读取下一条记录，checkpoint不为空时读到的是checkpoint（不含前缀），文件结束时返回io.EOF
+func (r *chainReader) next() (content string, hash []byte, checkpoint string, err error) {
+	if _, err = r.reader.Peek(1); err != nil {
+		return "", nil, "", err
+	}
+	if prefix, _ := r.reader.Peek(len(checkpointPrefix)); string(prefix) == checkpointPrefix {
+		line, err := r.reader.ReadString('\n')
+		if err == io.EOF {
+			return "", nil, "", errChainTruncated
+		}
+		if err != nil {
+			return "", nil, "", err
+		}
+		r.lineNumber++
+		return "", nil, strings.TrimSuffix(line[len(checkpointPrefix):], "\n"), nil
+	}
+
+	length, err := r.readLength()
+	if err != nil {
+		return "", nil, "", err
+	}
+	record := make([]byte, length+len(chainSeparator)+sha256.Size*2+1)
+	if _, err = io.ReadFull(r.reader, record); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", nil, "", errChainTruncated
+		}
+		return "", nil, "", err
+	}
+	trailer := record[length:]
+	if !bytes.HasPrefix(trailer, []byte(chainSeparator)) || trailer[len(trailer)-1] != '\n' {
+		return "", nil, "", errChainMalformed
+	}
+	hash, err = hex.DecodeString(string(trailer[len(chainSeparator) : len(trailer)-1]))
+	if err != nil {
+		return "", nil, "", errChainMalformed
+	}
+	content = string(record[:length])
+	r.lineNumber += strings.Count(content, "\n") + 1
+	return content, hash, "", nil
+}
+
+// 读取“<length>:”
+func (r *chainReader) readLength() (int, error) {
+	length := 0
+	for digits := 0; ; digits++ {
+		c, err := r.reader.ReadByte()
+		if err == io.EOF {
+			return 0, errChainTruncated
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c == ':' && digits > 0 {
+			return length, nil
+		}
+		if c < '0' || c > '9' || digits == chainLengthDigits {
+			return 0, errChainMalformed
+		}
+		length = length*10 + int(c-'0')
+		if length > maxChainRecordSize {
+			return 0, errChainMalformed
+		}
+	}
+}
+
+// The first problem found by VerifyIntegrity.
+type IntegrityError struct {
+	File    string
+	Line    int //问题记录的第一行
+	Message string
+}
+
+func (e *IntegrityError) Error() string {
+	return e.File + ":" + strconv.Itoa(e.Line) + ": " + e.Message
+}
+
+// The result of VerifyIntegrity.
+type IntegrityReport struct {
+	Files       []string //按编号顺序校验的文件
+	Missing     []int    //第一个文件之前已被删除的文件编号，之后的记录从签名的checkpoint开始校验
+	Records     int
+	Checkpoints int
+	Unsigned    int //最后一个checkpoint之后的记录数，其完整性没有签名保证
+}
+
+// Verifies the file set written by a file outputter with integrity="sha256-chain".
+// fileName is the filename attribute, the files numbered by "#" are verified in
+// order as one chain. The checkpoints are verified if key is not nil.
+// If the files before the first existing one were removed, their numbers are
+// listed in Missing and the chain continues from the signed checkpoint at the
+// start of the first existing file, a record before such a checkpoint is an error.
+// An *IntegrityError tells the first tampered line.
+func VerifyIntegrity(fileName string, key []byte) (report *IntegrityReport, err error) {
+	report = new(IntegrityReport)
+	var firstNumber int
+	report.Files, firstNumber, err = integrityFileSet(fileName)
+	if err != nil {
+		return report, err
+	}
+	if len(report.Files) == 0 {
+		return report, errors.New("there was no log file of " + fileName)
+	}
+	for number := 0; number < firstNumber; number++ {
+		report.Missing = append(report.Missing, number)
+	}
+
+	verifier := &chainVerifier{key: key, report: report, prev: make([]byte, sha256.Size)}
+	//之前的文件已被删除时，从第一个文件开头的checkpoint开始
+	verifier.isPartial = firstNumber != 0
+	for _, file := range report.Files {
+		err = verifier.verifyFile(file)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// 返回按编号排列的文件及第一个文件的编号，与fileWriter的自动编号规则一致
+func integrityFileSet(fileName string) (files []string, firstNumber int, err error) {
+	writer, err := newFileWriter(fileName, 0, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	folder, _ := filepath.Split(fileName)
+	matches, err := filepath.Glob(filepath.Join(folder, writer.filePrefixName+"*"+writer.fileSuffixName))
+	if err != nil {
+		return nil, 0, err
+	}
+	numbers := make(map[string]int)
+	files = make([]string, 0, len(matches))
+	for _, match := range matches {
+		base := filepath.Base(match)
+		if len(base) < len(writer.filePrefixName)+len(writer.fileSuffixName) {
+			continue
+		}
+		number, err := strconv.Atoi(base[len(writer.filePrefixName) : len(base)-len(writer.fileSuffixName)])
+		if err != nil {
+			continue
+		}
+		numbers[match] = number
+		files = append(files, match)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return numbers[files[i]] < numbers[files[j]]
+	})
+	if len(files) > 0 {
+		firstNumber = numbers[files[0]]
+	}
+	return files, firstNumber, nil
+}
+
+type chainVerifier struct {
+	key       []byte
+	report    *IntegrityReport
+	prev      []byte
+	isPartial bool //之前的文件已被删除，等待用于继续哈希链的checkpoint
+}
+
+func (verifier *chainVerifier) verifyFile(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := newChainReader(file)
+	for {
+		recordLine := reader.lineNumber
+		content, hash, checkpoint, err := reader.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err == errChainTruncated || err == errChainMalformed {
+			return &IntegrityError{fileName, recordLine, err.Error()}
+		}
+		if err != nil {
+			return err
+		}
+		if checkpoint != "" {
+			if err = verifier.verifyCheckpoint(checkpoint); err != nil {
+				return &IntegrityError{fileName, recordLine, err.Error()}
+			}
+			continue
+		}
+		if verifier.isPartial {
+			return &IntegrityError{fileName, recordLine, "the files " + formatNumbers(verifier.report.Missing) +
+				" before it were removed and the record is not anchored by a checkpoint"}
+		}
+		expected := chainHash(verifier.prev, content)
+		if !bytes.Equal(expected, hash) {
+			return &IntegrityError{fileName, recordLine, "record does not match its chain hash, it was modified, inserted or the previous record was removed"}
+		}
+		verifier.prev = hash
+		verifier.report.Records++
+		verifier.report.Unsigned++
+	}
+}
+
+// 以逗号分隔的编号
+func formatNumbers(numbers []int) string {
+	texts := make([]string, len(numbers))
+	for i, number := range numbers {
+		texts[i] = strconv.Itoa(number)
+	}
+	return strings.Join(texts, ",")
+}
+
+func (verifier *chainVerifier) verifyCheckpoint(signed string) error {
+	i := strings.LastIndex(signed, " hmac=")
+	if i < 0 {
+		return errors.New("checkpoint is malformed")
+	}
+	mac := signed[i+len(" hmac="):]
+	signed = signed[:i]
+	if verifier.key != nil && !hmac.Equal([]byte(mac), []byte(checkpointMAC(verifier.key, signed))) {
+		return errors.New("checkpoint signature is invalid, the checkpoint was forged or the key is wrong")
+	}
+	j := strings.LastIndex(signed, " chain=")
+	if j < 0 {
+		return errors.New("checkpoint is malformed")
+	}
+	chain := signed[j+len(" chain="):]
+	if verifier.isPartial {
+		//之前的文件已被删除，从签名的checkpoint开始
+		prev, err := hex.DecodeString(chain)
+		if err != nil || len(prev) != sha256.Size {
+			return errors.New("checkpoint is malformed")
+		}
+		verifier.prev = prev
+		verifier.isPartial = false
+	} else if chain != hex.EncodeToString(verifier.prev) {
+		return errors.New("checkpoint does not match the chain, records before it were modified")
+	}
+	verifier.report.Checkpoints++
+	verifier.report.Unsigned = 0
+	return nil
+}
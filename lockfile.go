@@ -0,0 +1,125 @@
+package vlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// 多个进程写入同一组日志文件时使用的锁文件，每次写入都持有flock，
+// 锁文件中保存当前编号，一个进程轮转后其他进程据此切换到新文件
+type fileLock struct {
+	fileName string //锁文件名，绝对路径
+	file     *os.File
+	perm     filePermissions
+}
+
+// 锁文件为日志文件名（含自动编号符号）加上“.lock”，如logs/log_###.log.lock
+func newFileLock(fileName string, perm filePermissions) *fileLock {
+	if !filepath.IsAbs(fileName) {
+		fileName = workingDir + fileName
+	}
+	return &fileLock{fileName: fileName + ".lock", perm: perm}
+}
+
+func (l *fileLock) lock() error {
+	if l.file == nil {
+		err := l.perm.mkdirAll(filepath.Dir(l.fileName))
+		if err != nil {
+			return err
+		}
+		l.file, err = l.perm.openFile(l.fileName, os.O_RDWR|os.O_CREATE)
+		if err != nil {
+			return err
+		}
+	}
+	return flock(l.file)
+}
+
+func (l *fileLock) unlock() error {
+	return funlock(l.file)
+}
+
+// 读取其他进程保存的编号，锁文件为空时ok为false
+func (l *fileLock) readNumber() (number int, ok bool) {
+	buf := make([]byte, 20)
+	n, _ := l.file.ReadAt(buf, 0)
+	number, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	return number, err == nil
+}
+
+func (l *fileLock) writeNumber(number int) error {
+	text := strconv.Itoa(number)
+	_, err := l.file.WriteAt([]byte(text), 0)
+	if err != nil {
+		return err
+	}
+	return l.file.Truncate(int64(len(text)))
+}
+
+func (l *fileLock) close() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// 与其他进程同步当前文件的编号和大小，调用者须持有lock和flock
+func (writer *fileWriter) syncWithLockFile() error {
+	number, ok := writer.lockFile.readNumber()
+	if !ok || number < writer.currentCountNumber {
+		//第一个使用锁文件的进程，或锁文件被删除后重新创建
+		return writer.lockFile.writeNumber(writer.currentCountNumber)
+	}
+	if number > writer.currentCountNumber {
+		//其他进程已轮转
+		writer.close()
+		writer.currentCountNumber = number
+		writer.currentStorageFileName = writer.storageFileNameByNumber(number)
+	}
+	info, err := os.Stat(writer.currentStorageFileName)
+	if err == nil {
+		writer.currentFileSize = info.Size()
+		return nil
+	}
+	if os.IsNotExist(err) {
+		//还未创建，或已被移走
+		writer.close()
+		writer.currentFileSize = 0
+		return nil
+	}
+	return err
+}
+
+// 为file或rulefile outputter开启多进程写入同一组日志文件的锁
+func enableLockFile(name string, writer *formattedWriter) error {
+	if !isFlockSupported {
+		return errors.New(name + "'s attribute lockfile is not supported on " + runtime.GOOS + ".")
+	}
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		if w.policy.bufferSize > 0 {
+			return errors.New(name + "'s attribute lockfile can not be used with buffersize.")
+		}
+		if w.chain != nil {
+			return errors.New(name + "'s attribute lockfile can not be used with integrity.")
+		}
+		w.lockFile = newFileLock(w.fileName, w.perm)
+	case *ruleFileWriter:
+		if w.policy.bufferSize > 0 {
+			return errors.New(name + "'s attribute lockfile can not be used with buffersize.")
+		}
+		if w.integrity != "" {
+			return errors.New(name + "'s attribute lockfile can not be used with integrity.")
+		}
+		w.isLockFile = true
+	default:
+		return errors.New(name + " does not support the lockfile attribute.")
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package vlog
+
+import (
+	"errors"
+	"os"
+)
+
+// 没有flock的平台不支持lockfile属性
+const isFlockSupported = false
+
+func flock(file *os.File) error {
+	return errors.New("flock is not supported")
+}
+
+func funlock(file *os.File) error {
+	return errors.New("flock is not supported")
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package vlog
+
+import (
+	"os"
+	"syscall"
+)
+
+const isFlockSupported = true
+
+func flock(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func funlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -1,9 +1,17 @@
 package vlog
 
-//日志等级类型
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//日志等级类型，数值越大越严重
 type LogLevel int8
 
-//日志等级常量
+//日志等级常量，数值保持不变；RegisterLevel注册的自定义等级低于trace（负数）或高于critical
 const (
 	LvTrace = iota
 	LvDebug
@@ -11,7 +19,15 @@ const (
 	LvWarn
 	LvError
 	LvCritical
-	lvImportant //需要输出到数据库的日志详细信息
+	//需要输出到数据库的日志详细信息，与严重程度无关：
+	//不受minlevel、maxlevel及exception限制，可通过outputter的levels属性单独输出
+	LvImportant = 100
+)
+
+//未设置minlevel、maxlevel时的等级范围，不限制自定义等级
+const (
+	lvLowest  LogLevel = math.MinInt8
+	lvHighest LogLevel = math.MaxInt8
 )
 
 //日志等级字符串表示
@@ -22,7 +38,7 @@ const (
 	lvWarnString      = "warn"
 	lvErrorString     = "error"
 	lvCriticalString  = "critical"
-	//lvImportantString = "important"
+	lvImportantString = "important"
 
 	lvTraceStr     = "TRA"
 	lvDebugStr     = "DEB"
@@ -30,7 +46,7 @@ const (
 	lvWarnStr      = "WAR"
 	lvErrorStr     = "ERR"
 	lvCriticalStr  = "CRI"
-	//lvImportantStr = "IMP"
+	lvImportantStr = "IMP"
 )
 
 //日志等级字符串表示 -> 日志等级
@@ -41,7 +57,7 @@ var lv4StringMap = map[string]LogLevel{
 	lvWarnString:      LvWarn,
 	lvErrorString:     LvError,
 	lvCriticalString:  LvCritical,
-	//lvImportantString: lvImportant,
+	lvImportantString: LvImportant,
 }
 
 //日志等级 -> 日志等级字符串表示
@@ -52,7 +68,7 @@ var lv2StringMap = map[LogLevel]string{
 	LvWarn:      lvWarnString,
 	LvError:     lvErrorString,
 	LvCritical:  lvCriticalString,
-	//lvImportant: lvImportantString,
+	LvImportant: lvImportantString,
 }
 
 //日志等级 -> 日志等级短字符串表示
@@ -63,11 +79,60 @@ var lv2StrMap = map[LogLevel]string{
 	LvWarn:      lvWarnStr,
 	LvError:     lvErrorStr,
 	LvCritical:  lvCriticalStr,
-	//lvImportant: lvImportantStr,
+	LvImportant: lvImportantStr,
+}
+
+//保护以上三个map，RegisterLevel可能与日志记录并发
+var levelsLock sync.RWMutex
+
+// Registers a custom level, usable everywhere a built-in level is: the levels,
+// minlevel and maxlevel attributes, the level tags of formatters and Log(level, ...).
+// The severity orders it among the built-in levels (LvTrace 0 to LvCritical 5), e.g.
+// RegisterLevel(6, "fatal", "FAT") is above critical and RegisterLevel(-1, "verbose", "VRB")
+// is below trace. name is used by %level and the configuration,
+// shortName by %LV and %lv. Levels must be registered before the configuration is loaded.
+func RegisterLevel(level LogLevel, name, shortName string) error {
+	if name == "" || shortName == "" {
+		return errors.New("level name and short name can not be empty.")
+	}
+	if strings.ContainsAny(name, ", ") {
+		return errors.New("level name can not contain comma or space: " + name + ".")
+	}
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	if existing, ok := lv2StringMap[level]; ok {
+		return errors.New("level " + strconv.Itoa(int(level)) + " is already registered as " + existing + ".")
+	}
+	if _, ok := lv4StringMap[name]; ok {
+		return errors.New("level name " + name + " is already registered.")
+	}
+	lv4StringMap[name] = level
+	lv2StringMap[level] = name
+	lv2StrMap[level] = shortName
+	return nil
+}
+
+//删除RegisterLevel注册的等级，供测试恢复全局状态
+func unregisterLevel(level LogLevel) {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	delete(lv4StringMap, lv2StringMap[level])
+	delete(lv2StringMap, level)
+	delete(lv2StrMap, level)
+}
+
+//按字符串表示查找日志等级
+func levelByName(name string) (LogLevel, bool) {
+	levelsLock.RLock()
+	defer levelsLock.RUnlock()
+	level, ok := lv4StringMap[name]
+	return level, ok
 }
 
 //返回日志等级字符串表示，方便打印
 func (lv LogLevel) String() string {
+	levelsLock.RLock()
+	defer levelsLock.RUnlock()
 	lvString, ok := lv2StringMap[lv]
 	if ok {
 		return lvString
@@ -77,6 +142,8 @@ func (lv LogLevel) String() string {
 
 //返回日志等级短字符串表示，方便打印
 func (lv LogLevel) ShortString() string {
+	levelsLock.RLock()
+	defer levelsLock.RUnlock()
 	lvStr, ok := lv2StrMap[lv]
 	if ok {
 		return lvStr
@@ -0,0 +1,210 @@
+package vlog
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 线程安全的计数器
+type counter struct {
+	value int64
+}
+
+func (c *counter) Add(delta int64) {
+	atomic.AddInt64(&c.value, delta)
+}
+
+func (c *counter) Load() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// 日志管道自身的统计信息
+type loggerStats struct {
+	lock     sync.RWMutex
+	messages map[LogLevel]*counter //各等级进入队列的消息数
+	errors   counter               //通过errorFunc报告的错误数
+	dropped  counter               //丢失的消息数
+}
+
+// 单个outputter的统计信息，由dispatcher记录
+type writerStats struct {
+	writes    counter
+	errors    counter
+	writeTime counter //累计写入耗时，纳秒
+}
+
+func (stats *writerStats) record(elapsed time.Duration, err error) {
+	stats.writes.Add(1)
+	stats.writeTime.Add(int64(elapsed))
+	if err != nil {
+		stats.errors.Add(1)
+	}
+}
+
+// 支持文件轮转的writer实现此接口以报告轮转次数
+type rotationReporter interface {
+	rotationCount() int64
+}
+
+var vlogStats = newLoggerStats()
+var publishExpvarOnce sync.Once
+
+func newLoggerStats() *loggerStats {
+	stats := new(loggerStats)
+	stats.messages = make(map[LogLevel]*counter)
+	return stats
+}
+
+func (stats *loggerStats) messageCounter(level LogLevel) *counter {
+	stats.lock.RLock()
+	c, ok := stats.messages[level]
+	stats.lock.RUnlock()
+	if ok {
+		return c
+	}
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if c, ok = stats.messages[level]; !ok {
+		c = new(counter)
+		stats.messages[level] = c
+	}
+	return c
+}
+
+func publishExpvar() {
+	publishExpvarOnce.Do(func() {
+		expvar.Publish("vlog", expvar.Func(func() interface{} {
+			return GetStats()
+		}))
+	})
+}
+
+//==============================================================================
+
+// Snapshot of the logging pipeline counters.
+type Stats struct {
+	QueueLength   int              //logger队列中等待分发的消息数
+	QueueCapacity int              //logger队列的容量
+	Messages      map[string]int64 //各等级进入队列的消息数
+	Errors        int64            //通过errorFunc报告的错误数
+	Dropped       int64            //丢失的消息数
+	Outputters    []OutputterStats
+}
+
+// Counters of the outputters sharing the same type and formatter id.
+type OutputterStats struct {
+	Type        string
+	FormatterID string
+	Writes      int64
+	WriteErrors int64
+	WriteTime   time.Duration
+	Rotations   int64
+	QueueLength int //异步outputter队列中等待写入的消息数
+}
+
+// Returns the current counters of the logging pipeline.
+func GetStats() Stats {
+	stats := Stats{Messages: make(map[string]int64)}
+	stats.Errors = vlogStats.errors.Load()
+	stats.Dropped = vlogStats.dropped.Load()
+	vlogStats.lock.RLock()
+	for level, c := range vlogStats.messages {
+		stats.Messages[level.String()] = c.Load()
+	}
+	vlogStats.lock.RUnlock()
+
+	log := vloggerInstance.Load()
+	if log == nil {
+		return stats
+	}
+	stats.QueueLength = len(log.messages)
+	stats.QueueCapacity = cap(log.messages)
+
+	index := make(map[string]int)
+	for _, writer := range log.disp.allWriters() {
+		key := writer.writerType + "\x00" + writer.formatter.id
+		i, ok := index[key]
+		if !ok {
+			i = len(stats.Outputters)
+			index[key] = i
+			stats.Outputters = append(stats.Outputters,
+				OutputterStats{Type: writer.writerType, FormatterID: writer.formatter.id})
+		}
+		outputter := &stats.Outputters[i]
+		outputter.Writes += writer.stats.writes.Load()
+		outputter.WriteErrors += writer.stats.errors.Load()
+		outputter.WriteTime += time.Duration(writer.stats.writeTime.Load())
+		if writer.async != nil {
+			outputter.QueueLength += writer.async.length()
+		}
+		if reporter, ok := writer.writer.(rotationReporter); ok {
+			outputter.Rotations += reporter.rotationCount()
+		}
+	}
+	return stats
+}
+
+// Returns a http.Handler exposing the counters of GetStats
+// in the Prometheus text format.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheusMetrics(w, GetStats())
+	})
+}
+
+func writePrometheusMetrics(w io.Writer, stats Stats) {
+	writeMetricHeader(w, "vlog_queue_length", "gauge", "Number of messages waiting to be dispatched.")
+	fmt.Fprintf(w, "vlog_queue_length %d\n", stats.QueueLength)
+	writeMetricHeader(w, "vlog_queue_capacity", "gauge", "Capacity of the message queue.")
+	fmt.Fprintf(w, "vlog_queue_capacity %d\n", stats.QueueCapacity)
+
+	levels := make([]string, 0, len(stats.Messages))
+	for level := range stats.Messages {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	writeMetricHeader(w, "vlog_messages_total", "counter", "Number of messages enqueued per level.")
+	for _, level := range levels {
+		fmt.Fprintf(w, "vlog_messages_total{level=%q} %d\n", level, stats.Messages[level])
+	}
+	writeMetricHeader(w, "vlog_errors_total", "counter", "Number of errors reported by the logger.")
+	fmt.Fprintf(w, "vlog_errors_total %d\n", stats.Errors)
+	writeMetricHeader(w, "vlog_dropped_messages_total", "counter", "Number of messages lost.")
+	fmt.Fprintf(w, "vlog_dropped_messages_total %d\n", stats.Dropped)
+
+	writeMetricHeader(w, "vlog_outputter_writes_total", "counter", "Number of writes per outputter.")
+	for _, o := range stats.Outputters {
+		fmt.Fprintf(w, "vlog_outputter_writes_total{%s} %d\n", outputterLabels(o), o.Writes)
+	}
+	writeMetricHeader(w, "vlog_outputter_write_errors_total", "counter", "Number of failed writes per outputter.")
+	for _, o := range stats.Outputters {
+		fmt.Fprintf(w, "vlog_outputter_write_errors_total{%s} %d\n", outputterLabels(o), o.WriteErrors)
+	}
+	writeMetricHeader(w, "vlog_outputter_write_seconds_total", "counter", "Time spent writing per outputter.")
+	for _, o := range stats.Outputters {
+		fmt.Fprintf(w, "vlog_outputter_write_seconds_total{%s} %g\n", outputterLabels(o), o.WriteTime.Seconds())
+	}
+	writeMetricHeader(w, "vlog_outputter_queue_length", "gauge", "Number of messages waiting in the queue of async outputters.")
+	for _, o := range stats.Outputters {
+		fmt.Fprintf(w, "vlog_outputter_queue_length{%s} %d\n", outputterLabels(o), o.QueueLength)
+	}
+	writeMetricHeader(w, "vlog_outputter_rotations_total", "counter", "Number of log file rotations per outputter.")
+	for _, o := range stats.Outputters {
+		fmt.Fprintf(w, "vlog_outputter_rotations_total{%s} %d\n", outputterLabels(o), o.Rotations)
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func outputterLabels(o OutputterStats) string {
+	return fmt.Sprintf("outputter=%q,formatter=%q", o.Type, o.FormatterID)
+}
@@ -0,0 +1,149 @@
+package vlog
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// vlog创建的日志文件和目录的权限及属组，零值为默认：按umask创建，不修改属组
+type filePermissions struct {
+	fileMode   os.FileMode //不为0时创建文件后设置为此权限，不受umask影响
+	dirMode    os.FileMode //不为0时创建目录后设置为此权限，不受umask影响
+	gid        int
+	isGroupSet bool //为true时创建后将属组修改为gid
+}
+
+// 运行时错误日志的权限，由vlog元素的filemode、dirmode、group属性设置
+var runtimeErrorLogPermissions filePermissions
+
+// 返回以filePermissions为默认值、被不为零值的参数覆盖的权限，group为组名或gid
+func (perm filePermissions) override(fileMode, dirMode os.FileMode, group string) (filePermissions, error) {
+	if fileMode&^os.ModePerm != 0 || dirMode&^os.ModePerm != 0 {
+		return perm, errors.New("file mode can only have the permission bits.")
+	}
+	if fileMode != 0 {
+		perm.fileMode = fileMode
+	}
+	if dirMode != 0 {
+		perm.dirMode = dirMode
+	}
+	if group != "" {
+		gid, err := lookupGroup(group)
+		if err != nil {
+			return perm, err
+		}
+		perm.gid = gid
+		perm.isGroupSet = true
+	}
+	return perm, nil
+}
+
+// 解析filemode、dirmode、group属性，覆盖perm中的值
+func (perm filePermissions) overrideByAttrs(element string, fileMode, dirMode, group configValue) (filePermissions, error) {
+	modes := make([]os.FileMode, 2)
+	for i, value := range []configValue{fileMode, dirMode} {
+		if value == "" {
+			continue
+		}
+		mode, err := strconv.ParseUint(string(value), 8, 32)
+		if err != nil || mode == 0 || mode > uint64(os.ModePerm) {
+			return perm, errors.New(element + "'s attribute " + []string{"filemode", "dirmode"}[i] +
+				" value is illegal: " + string(value) + ", it must be an octal number like 0640.")
+		}
+		modes[i] = os.FileMode(mode)
+	}
+	perm, err := perm.override(modes[0], modes[1], string(group))
+	if err != nil {
+		return perm, errors.New(element + "'s attribute group value is illegal: " + err.Error())
+	}
+	return perm, nil
+}
+
+func lookupGroup(group string) (int, error) {
+	if g, err := user.LookupGroup(group); err == nil {
+		return strconv.Atoi(g.Gid)
+	}
+	gid, err := strconv.Atoi(group)
+	if err != nil || gid < 0 {
+		return 0, errors.New("unknown group " + group + ".")
+	}
+	return gid, nil
+}
+
+// 打开文件，不存在时按权限创建
+func (perm filePermissions) openFile(name string, flag int) (*os.File, error) {
+	_, statErr := os.Stat(name)
+	mode := os.FileMode(defaultFilePermissions)
+	if perm.fileMode != 0 {
+		mode = perm.fileMode
+	}
+	file, err := os.OpenFile(name, flag, mode)
+	if err != nil || !os.IsNotExist(statErr) {
+		return file, err
+	}
+	if perm.fileMode != 0 {
+		err = file.Chmod(perm.fileMode)
+	}
+	if err == nil && perm.isGroupSet {
+		err = file.Chown(-1, perm.gid)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// 创建目录及不存在的上级目录，只修改新创建的目录的权限和属组
+func (perm filePermissions) mkdirAll(dir string) error {
+	created := make([]string, 0)
+	for path := filepath.Clean(dir); ; path = filepath.Dir(path) {
+		if _, err := os.Stat(path); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		created = append(created, path)
+		if filepath.Dir(path) == path {
+			break
+		}
+	}
+	mode := os.FileMode(defaultDirectoryPermissions)
+	if perm.dirMode != 0 {
+		mode = perm.dirMode
+	}
+	err := os.MkdirAll(dir, mode)
+	if err != nil {
+		return err
+	}
+	for _, path := range created {
+		if perm.dirMode != 0 {
+			if err = os.Chmod(path, perm.dirMode); err != nil {
+				return err
+			}
+		}
+		if perm.isGroupSet {
+			if err = os.Lchown(path, -1, perm.gid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 为file或rulefile outputter设置日志文件和目录的权限及属组
+func enablePermissions(name string, writer *formattedWriter, perm filePermissions) error {
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		w.perm = perm
+		if w.lockFile != nil {
+			w.lockFile.perm = perm
+		}
+	case *ruleFileWriter:
+		w.perm = perm
+	default:
+		return errors.New(name + " does not support the filemode, dirmode and group attributes.")
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package vlog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The built-in detectors of RedactRule.Detectors.
+const (
+	RedactCard   = "card"   //银行卡号，通过Luhn校验的13~19位数字，可含空格或“-”
+	RedactBearer = "bearer" //Authorization头中的Bearer令牌
+	RedactEmail  = "email"
+	RedactIDCard = "idcard" //18位居民身份证号，校验码正确
+	RedactPhone  = "phone"  //中国大陆手机号，可带+86
+	RedactAll    = "all"    //以上全部
+)
+
+// The actions of RedactRule.
+const (
+	RedactMask = "mask" //替换为redactMaskString，默认
+	RedactHash = "hash" //替换为以RedactRule.Key计算的HMAC-SHA256的前16位，相同的值得到相同的结果，便于关联
+	RedactDrop = "drop" //不写入含敏感数据的消息
+)
+
+const redactMaskString = "******"
+
+// A redaction rule applied to the message and the fields before formatting.
+// The rules of the vlog element apply to all outputters, followed by the
+// rules of the outputter, so an outputter can be stricter than the others.
+// The drop rules are checked first against the original message and fields.
+type RedactRule struct {
+	Detectors []string //内置检测器，见RedactCard等
+	Pattern   string   //正则表达式，有分组时只替换第一个分组
+	//字段名（不区分大小写），字段值整体被处理，消息中的name=value、"name":"value"同样处理
+	Fields []string
+	Action string //RedactMask、RedactHash、RedactDrop，默认RedactMask
+	//RedactHash的HMAC密钥，必须设置。没有密钥时手机号等取值范围小的数据可以被穷举还原
+	Key string
+}
+
+// 查找敏感数据的正则表达式，isValid不为nil时只处理通过检查的匹配
+type redactMatcher struct {
+	reg     *regexp.Regexp
+	isValid func(value string) bool
+}
+
+var redactDetectors = map[string]*redactMatcher{
+	RedactCard:   {regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), isLuhnValid},
+	RedactBearer: {regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`), nil},
+	RedactEmail:  {regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`), nil},
+	RedactIDCard: {regexp.MustCompile(`\b[1-9]\d{16}[\dXx]\b`), isIDCardValid},
+	RedactPhone:  {regexp.MustCompile(`(?:\+86[- ]?|\b86[- ]?|\b)1[3-9]\d{9}\b`), nil},
+}
+
+// RedactAll的检测顺序，身份证号、手机号先于银行卡号，避免被当作银行卡号处理
+var redactDetectorNames = []string{RedactIDCard, RedactPhone, RedactCard, RedactBearer, RedactEmail}
+
+func isLuhnValid(value string) bool {
+	sum, count := 0, 0
+	for i := len(value) - 1; i >= 0; i-- {
+		c := value[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if count%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		count++
+	}
+	return count >= 13 && count <= 19 && sum%10 == 0
+}
+
+// GB 11643校验码
+func isIDCardValid(value string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, weight := range weights {
+		sum += int(value[i]-'0') * weight
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(value[17:])[0]
+}
+
+type redactRule struct {
+	action   string
+	key      []byte //RedactHash的HMAC密钥
+	matchers []*redactMatcher
+	fields   map[string]bool //小写的字段名
+}
+
+func newRedactRule(rule RedactRule) (r *redactRule, err error) {
+	r = new(redactRule)
+	switch rule.Action {
+	case "":
+		r.action = RedactMask
+	case RedactMask, RedactHash, RedactDrop:
+		r.action = rule.Action
+	default:
+		return nil, errors.New("redact's attribute action value is illegal: " + rule.Action + ".")
+	}
+	if r.action == RedactHash {
+		if rule.Key == "" {
+			return nil, errors.New("redact with action=\"hash\" must have key attribute.")
+		}
+		r.key = []byte(rule.Key)
+	}
+	for _, name := range rule.Detectors {
+		if name == RedactAll {
+			for _, detector := range redactDetectorNames {
+				r.matchers = append(r.matchers, redactDetectors[detector])
+			}
+			continue
+		}
+		detector, ok := redactDetectors[name]
+		if !ok {
+			return nil, errors.New("redact's attribute detectors value is illegal: " + name + ".")
+		}
+		r.matchers = append(r.matchers, detector)
+	}
+	if rule.Pattern != "" {
+		reg, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.New("redact's attribute pattern value is illegal: " + err.Error())
+		}
+		r.matchers = append(r.matchers, &redactMatcher{reg, nil})
+	}
+	if len(rule.Fields) > 0 {
+		r.fields = make(map[string]bool, len(rule.Fields))
+		names := make([]string, 0, len(rule.Fields))
+		for _, name := range rule.Fields {
+			if name == "" {
+				continue
+			}
+			r.fields[strings.ToLower(name)] = true
+			names = append(names, regexp.QuoteMeta(name))
+		}
+		if len(names) > 0 {
+			//消息中的password=xxx、"password": "xxx"
+			r.matchers = append(r.matchers, &redactMatcher{regexp.MustCompile(`(?i)\b(?:` +
+				strings.Join(names, "|") + `)\b["']?\s*[=:]\s*["']?([^\s"',;&]+)`), nil})
+		}
+	}
+	if len(r.matchers) == 0 {
+		return nil, errors.New("redact must have detectors, pattern or fields attribute.")
+	}
+	return r, nil
+}
+
+func (r *redactRule) replace(value string) string {
+	if r.action == RedactHash {
+		mac := hmac.New(sha256.New, r.key)
+		mac.Write([]byte(value))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+	return redactMaskString
+}
+
+// 处理字符串中的全部敏感数据，返回处理后的字符串及是否找到敏感数据
+func (r *redactRule) redactString(s string) (string, bool) {
+	isFound := false
+	for _, matcher := range r.matchers {
+		indexes := matcher.reg.FindAllStringSubmatchIndex(s, -1)
+		if indexes == nil {
+			continue
+		}
+		buf := bytes.NewBufferString("")
+		last := 0
+		for _, index := range indexes {
+			start, end := index[0], index[1]
+			if len(index) > 2 && index[2] >= 0 {
+				//只替换第一个分组
+				start, end = index[2], index[3]
+			}
+			if matcher.isValid != nil && !matcher.isValid(s[start:end]) {
+				continue
+			}
+			buf.WriteString(s[last:start])
+			buf.WriteString(r.replace(s[start:end]))
+			last = end
+			isFound = true
+		}
+		buf.WriteString(s[last:])
+		s = buf.String()
+	}
+	return s, isFound
+}
+
+func (r *redactRule) redactField(name string, value interface{}) (string, bool) {
+	if r.fields[strings.ToLower(name)] {
+		return r.replace(fmt.Sprint(value)), true
+	}
+	return r.redactString(fmt.Sprint(value))
+}
+
+// outputter的全部redact规则
+type redactor struct {
+	rules []*redactRule
+}
+
+// 没有规则时返回nil
+func newRedactor(rules []RedactRule) (*redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	r := new(redactor)
+	others := make([]*redactRule, 0, len(rules))
+	for _, rule := range rules {
+		redactRule, err := newRedactRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		//drop规则先于其他规则，检查未被替换的原始内容
+		if redactRule.action == RedactDrop {
+			r.rules = append(r.rules, redactRule)
+		} else {
+			others = append(others, redactRule)
+		}
+	}
+	r.rules = append(r.rules, others...)
+	return r, nil
+}
+
+// 依次应用全部规则，ok为false时不写入此消息
+func (r *redactor) redact(message string, context runtimeContextInterface) (string, runtimeContextInterface, bool) {
+	fields := context.Fields()
+	isFieldsCopied := false
+	//%err、%stack输出的内容同样处理
+	stack := context.Stack()
+	errs := newErrorEntries(context.Err())
+	isErrChanged := false
+	for _, rule := range r.rules {
+		var isFound, ok bool
+		message, isFound = rule.redactString(message)
+		if stack, ok = rule.redactString(stack); ok {
+			isFound, isErrChanged = true, true
+		}
+		for i := range errs {
+			if errs[i].text, ok = rule.redactString(errs[i].text); ok {
+				isFound, isErrChanged = true, true
+			}
+			if errs[i].stack, ok = rule.redactString(errs[i].stack); ok {
+				isFound, isErrChanged = true, true
+			}
+		}
+		for name, value := range fields {
+			redacted, ok := rule.redactField(name, value)
+			if !ok {
+				continue
+			}
+			isFound = true
+			if !isFieldsCopied {
+				//字段属于消息本身，其他outputter可能使用不同的规则
+				fields = copyFields(fields)
+				isFieldsCopied = true
+			}
+			fields[name] = redacted
+		}
+		if isFound && rule.action == RedactDrop {
+			return "", context, false
+		}
+	}
+	if isFieldsCopied || isErrChanged {
+		redacted := &redactedContext{context, fields, context.Err(), stack}
+		if isErrChanged {
+			redacted.err = newRedactedError(errs)
+		}
+		context = redacted
+	}
+	return message, context, true
+}
+
+func copyFields(fields Fields) Fields {
+	copied := make(Fields, len(fields))
+	for name, value := range fields {
+		copied[name] = value
+	}
+	return copied
+}
+
+// 字段、错误或调用栈被处理后的上下文
+type redactedContext struct {
+	runtimeContextInterface
+	fields Fields
+	err    error
+	stack  string
+}
+
+func (context *redactedContext) Fields() Fields {
+	return context.fields
+}
+
+func (context *redactedContext) Err() error {
+	return context.err
+}
+
+func (context *redactedContext) Stack() string {
+	return context.stack
+}
+
+// 错误链（errors.Unwrap）中一个错误的文本和自带的调用栈
+type errorEntry struct {
+	text  string
+	stack string
+}
+
+func newErrorEntries(err error) (entries []errorEntry) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		entries = append(entries, errorEntry{err.Error(), errorStackTrace(err)})
+	}
+	return entries
+}
+
+// 代替被处理的错误，保持错误链的结构，%err输出与原错误格式相同
+type redactedError struct {
+	text  string
+	stack string
+	cause error
+}
+
+func newRedactedError(entries []errorEntry) error {
+	var err error
+	for i := len(entries) - 1; i >= 0; i-- {
+		err = &redactedError{entries[i].text, entries[i].stack, err}
+	}
+	return err
+}
+
+func (err *redactedError) Error() string {
+	return err.text
+}
+
+func (err *redactedError) Unwrap() error {
+	return err.cause
+}
+
+// 供errorStackTrace读取
+func (err *redactedError) StackTrace() string {
+	return err.stack
+}
@@ -0,0 +1,125 @@
+package vlog
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How often an outputter with reopenonmove="true" checks whether its file was
+// moved or deleted, the check is done before a write.
+var DefaultMoveCheckInterval = time.Second
+
+// Closes the files of all file and rulefile outputters, they are opened again
+// by the next write. Call it after an external tool like logrotate moved the
+// files, the buffered data is written to the old files first.
+func ReopenFiles() error {
+	log := vloggerInstance.Load()
+	if log == nil {
+		return nil
+	}
+	errMsg := ""
+	for _, writer := range log.disp.allWriters() {
+		var err error
+		switch w := writer.writer.(type) {
+		case *fileWriter:
+			err = w.reopen()
+		case *ruleFileWriter:
+			err = w.reopen()
+		}
+		if err != nil {
+			errMsg += writer.writerType + ": " + err.Error() + ","
+		}
+	}
+	if errMsg != "" {
+		return errors.New("some writer reopened error: " + errMsg[:len(errMsg)-1])
+	}
+	return nil
+}
+
+// Calls ReopenFiles when the process receives SIGHUP, like the convention of
+// daemons for logrotate. Errors are reported to the error handler. The returned
+// function stops handling the signal.
+func HandleSIGHUP() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-signals:
+				if err := ReopenFiles(); err != nil {
+					errorFunc(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// 关闭当前文件，下次写入时重新确定文件名并打开
+func (writer *fileWriter) reopen() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	err := writer.close()
+	writer.resetStorageFile()
+	return err
+}
+
+// 文件可能已被移走，重新扫描日志目录确定编号和大小
+func (writer *fileWriter) resetStorageFile() {
+	writer.currentStorageFileName = ""
+	writer.currentCountNumber = 0
+	writer.currentFileSize = 0
+}
+
+func (writer *ruleFileWriter) reopen() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	errMsg := ""
+	for fileName, fWriter := range writer.fileWriters {
+		if err := fWriter.reopen(); err != nil {
+			errMsg += fileName + " reopened error: " + err.Error() + ","
+		}
+	}
+	if errMsg != "" {
+		return errors.New("some fileWriter reopened error: [" + errMsg[:len(errMsg)-1] + "]")
+	}
+	return nil
+}
+
+// 当前文件被移走或删除时关闭，调用者须持有lock
+func (writer *fileWriter) checkMoved() error {
+	if writer.innerWriter == nil || writer.openedFile == nil ||
+		time.Since(writer.lastMoveCheckTime) < DefaultMoveCheckInterval {
+		return nil
+	}
+	writer.lastMoveCheckTime = time.Now()
+	info, err := os.Stat(writer.currentStorageFileName)
+	if err == nil && os.SameFile(info, writer.openedFile) {
+		return nil
+	}
+	err = writer.close()
+	writer.resetStorageFile()
+	return err
+}
+
+// 为file或rulefile outputter开启文件移动检测
+func enableReopenOnMove(name string, writer *formattedWriter) error {
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		w.isReopenOnMove = true
+	case *ruleFileWriter:
+		w.isReopenOnMove = true
+	default:
+		return errors.New(name + " does not support the reopenonmove attribute.")
+	}
+	return nil
+}
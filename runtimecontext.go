@@ -1,7 +1,9 @@
 package vlog
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -43,6 +45,12 @@ type runtimeContextInterface interface {
 	IsValid() bool
 	// Time when log func was called
 	CallTime() time.Time
+	// Caller stack trace, empty if it was not captured
+	Stack() string
+	// The error passed among log params, nil if there was none
+	Err() error
+	// The Fields passed among log params, nil if there were none
+	Fields() Fields
 }
 
 // Returns context of the caller
@@ -86,6 +94,13 @@ func extractCallerInfo(skip int) (fullPath string, shortPath string, funcName st
 // occurs, the returned context is an error context, which contains no paths
 // or names, but states that they can't be extracted.
 func specificContext(skip int) (runtimeContextInterface, error) {
+	return specificContextWithStack(skip+1, 0)
+}
+
+// Same as specificContext, but also captures at most stackDepth frames of the
+// caller stack. The stack is not captured if stackDepth <= 0, it is expensive
+// and only needed when some formatter uses the %stack tag.
+func specificContextWithStack(skip int, stackDepth int) (runtimeContextInterface, error) {
 	callTime := time.Now()
 
 	if skip < 0 {
@@ -98,7 +113,32 @@ func specificContext(skip int) (runtimeContextInterface, error) {
 		return &errorContext{callTime, err}, err
 	}
 	_, fileName := filepath.Split(fullPath)
-	return &logContext{function, line, shortPath, fullPath, fileName, callTime}, nil
+	context := &logContext{funcName: function, line: line, shortPath: shortPath,
+		fullPath: fullPath, fileName: fileName, callTime: callTime}
+	if stackDepth > 0 {
+		context.stack = extractCallerStack(skip+2, stackDepth)
+	}
+	return context, nil
+}
+
+// Returns at most depth frames of the stack, one "func\n\tfile:line\n" per frame,
+// the same layout as a panic stack trace
+func extractCallerStack(skip int, depth int) string {
+	pcs := make([]uintptr, depth)
+	n := runtime.Callers(skip+1, pcs)
+	if n == 0 {
+		return ""
+	}
+	frames := runtime.CallersFrames(pcs[:n])
+	buf := bytes.NewBufferString("")
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(buf, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return buf.String()
 }
 
 // Represents a normal runtime caller context
@@ -109,6 +149,9 @@ type logContext struct {
 	fullPath  string
 	fileName  string
 	callTime  time.Time
+	stack     string
+	err       error
+	fields    Fields
 }
 
 func (context *logContext) IsValid() bool {
@@ -139,6 +182,18 @@ func (context *logContext) CallTime() time.Time {
 	return context.callTime
 }
 
+func (context *logContext) Stack() string {
+	return context.stack
+}
+
+func (context *logContext) Err() error {
+	return context.err
+}
+
+func (context *logContext) Fields() Fields {
+	return context.fields
+}
+
 const (
 	errorContextFunc      = "Func() error:"
 	errorContextShortPath = "ShortPath() error:"
@@ -178,4 +233,16 @@ func (errContext *errorContext) FileName() string {
 
 func (errContext *errorContext) CallTime() time.Time {
 	return errContext.errorTime
+}
+
+func (errContext *errorContext) Stack() string {
+	return ""
+}
+
+func (errContext *errorContext) Err() error {
+	return nil
+}
+
+func (errContext *errorContext) Fields() Fields {
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,58 @@
+package vlog
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// 为file或rulefile outputter设置指向当前日志文件的符号链接，
+// 符号链接名与filename一样可以使用标签，file只支持%pid
+func enableSymlink(name string, writer *formattedWriter, symlink string) (err error) {
+	if symlink == "" {
+		return nil
+	}
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		w.symlink = expandPid(symlink)
+	case *ruleFileWriter:
+		w.symlinkFormatter, err = newFormatter(symlink, fileNameTags)
+		if err != nil {
+			return errors.New(name + "'s attribute symlink value is illegal: " + err.Error())
+		}
+	default:
+		return errors.New(name + " does not support the symlink attribute.")
+	}
+	return nil
+}
+
+// 使符号链接指向target，先创建临时链接再重命名，读取链接的程序不会看到链接不存在
+func updateSymlink(symlink, target string, perm filePermissions) error {
+	if !filepath.IsAbs(symlink) {
+		symlink = workingDir + symlink
+	}
+	//链接与文件在同一目录树中时使用相对路径，目录整体移动后链接仍然有效
+	if rel, err := filepath.Rel(filepath.Dir(symlink), target); err == nil {
+		target = rel
+	}
+	if current, err := os.Readlink(symlink); err == nil && current == target {
+		return nil
+	}
+	err := perm.mkdirAll(filepath.Dir(symlink))
+	if err != nil {
+		return err
+	}
+	//临时链接名含进程号和随机数，多个进程（或outputter）同时更新时互不影响
+	tmp := symlink + "." + processID + "." + strconv.FormatUint(uint64(rand.Uint32()), 36) + ".tmp"
+	err = os.Symlink(target, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, symlink)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
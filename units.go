@@ -0,0 +1,86 @@
+package vlog
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 大小单位，与DefaultAllowedFileMaxSize一样按1024进位，KB、KiB、K含义相同
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+var sizeReg = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([A-Za-z]*)$`)
+
+// 解析maxsize、buffersize等属性的字节数，如"200MB"、"1.5GiB"、"65536"（无单位为字节）
+func parseSize(text string) (int64, error) {
+	s := strings.TrimSpace(text)
+	if strings.HasPrefix(s, "-") {
+		return 0, errors.New("size \"" + text + "\" can not be negative.")
+	}
+	matches := sizeReg.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, errors.New("size \"" + text + "\" is not a number with an optional unit, like 200MB.")
+	}
+	unit, ok := sizeUnits[strings.ToLower(matches[2])]
+	if !ok {
+		return 0, errors.New("size \"" + text + "\" has unknown unit \"" + matches[2] + "\", use B, KB, MB, GB or TB.")
+	}
+	if !strings.Contains(matches[1], ".") {
+		number, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || number > math.MaxInt64/unit {
+			return 0, errors.New("size \"" + text + "\" is too large.")
+		}
+		return number * unit, nil
+	}
+	number, _ := strconv.ParseFloat(matches[1], 64)
+	size := number * float64(unit)
+	if size >= math.MaxInt64 {
+		return 0, errors.New("size \"" + text + "\" is too large.")
+	}
+	return int64(size), nil
+}
+
+var daysReg = regexp.MustCompile(`^([0-9]+)d(.*)$`)
+
+// 解析flushinterval、idletimeout等属性的时长，格式同time.ParseDuration，另外支持天，如"7d"、"1d12h"
+func parseDuration(text string) (time.Duration, error) {
+	s := strings.TrimSpace(text)
+	if strings.HasPrefix(s, "-") {
+		return 0, errors.New("duration \"" + text + "\" can not be negative.")
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil && s != "0" {
+		return 0, errors.New("duration \"" + text + "\" has no unit, use ns, us, ms, s, m, h or d, like 30s.")
+	}
+	var days time.Duration
+	if matches := daysReg.FindStringSubmatch(s); matches != nil {
+		number, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || number > int64(math.MaxInt64/(24*time.Hour)) {
+			return 0, errors.New("duration \"" + text + "\" is too large.")
+		}
+		days = time.Duration(number) * 24 * time.Hour
+		if s = matches[2]; s == "" {
+			return days, nil
+		}
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.New("duration \"" + text + "\" is illegal, use a number with unit ns, us, ms, s, m, h or d, like 1h30m.")
+	}
+	if duration < 0 {
+		return 0, errors.New("duration \"" + text + "\" can not be negative.")
+	}
+	if duration > math.MaxInt64-days {
+		return 0, errors.New("duration \"" + text + "\" is too large.")
+	}
+	return days + duration, nil
+}
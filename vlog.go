@@ -4,16 +4,45 @@
 package vlog
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var RUNTIME_ERROR_LOG_FILENAME = "vlog_runtime_error.log"
 
-var vloggerInstance *logger
-var logMessages chan logMessage
+//当前配置的runtimeerrorlog，每次初始化时重置，为空时使用RUNTIME_ERROR_LOG_FILENAME
+var runtimeErrorLogFileName string
+
+// Time Close waits for the queued messages to be written.
+var DefaultShutdownTimeout = 10 * time.Second
+
+var ErrLoggerClosed = errors.New("vlog: logger is closed")
+
+// 当前logger，记录日志时无锁读取，初始化时持有initLock替换
+var vloggerInstance loggerPointer
+
+// 可并发读写的logger指针
+type loggerPointer struct {
+	value atomic.Value
+}
+
+func (p *loggerPointer) Load() *logger {
+	log, _ := p.value.Load().(*logger)
+	return log
+}
+
+func (p *loggerPointer) Store(log *logger) {
+	p.value.Store(log)
+}
+
+// 初始化logger时持有，避免并发的延迟初始化重复创建logger
+var initLock sync.Mutex
 //const logSepStr = "|"
 
 type logger struct {
@@ -22,6 +51,21 @@ type logger struct {
 	minLevel LogLevel
 	disp     *dispatcher
 	isClosed bool
+	//此logger的消息队列，重新初始化后旧logger的分发goroutine仍使用自己的队列
+	messages chan logMessage
+	//调用栈层数，取所有formatter中%stack要求的最大值
+	stackDepth int
+
+	//发送消息时持有读锁，关闭messages时持有写锁，避免向已关闭的channel发送消息
+	sendLock    sync.RWMutex
+	isStopped   bool          //不再接受新消息
+	isAbandoned int32         //超过关闭期限，剩余的消息不再写入
+	inFlight    int32         //分发goroutine已取出、尚未写完的消息数，关闭超时时计入丢失的消息
+	stopped     chan struct{} //分发goroutine结束时关闭
+	isDefault   bool          //使用默认配置创建，初始化新logger时关闭
+
+	exceptions     []*levelException //按顺序匹配，第一个匹配的exception生效
+	exceptionCache exceptionCache
 }
 
 func getLoggerInstance(config *configuration) (log *logger, err error) {
@@ -33,30 +77,94 @@ func getLoggerInstance(config *configuration) (log *logger, err error) {
 	log = new(logger)
 	log.maxLevel = config.maxLevel
 	log.minLevel = config.minLevel
+	log.exceptions = config.exceptions
 	log.disp = disp
-	log.isClosed = false	
+	log.isClosed = false
+	log.stopped = make(chan struct{})
+	for _, writer := range config.writers {
+		if depth := writer.stackDepth(); depth > log.stackDepth {
+			log.stackDepth = depth
+		}
+	}
 	return log, nil
 }
 
 func (log *logger) start() {
-	go dispatchLogMessage()
+	go log.dispatchLogMessage()
+}
+
+// 返回当前logger，尚未初始化时按默认配置初始化
+func getLogger() *logger {
+	if log := vloggerInstance.Load(); log != nil {
+		return log
+	}
+	initLock.Lock()
+	defer initLock.Unlock()
+	if vloggerInstance.Load() == nil {
+		err := initLazyLogger()
+		if err != nil {
+			errorFunc(err)
+		}
+	}
+	return vloggerInstance.Load()
+}
+
+// 设置了VLOG_CONFIG时使用该配置文件，否则（或配置文件有误时）使用默认配置
+func initLazyLogger() error {
+	if fileName := os.Getenv(EnvConfig); fileName != "" {
+		config, err := loadConfigurationFromFile(fileName)
+		if err == nil {
+			return initLoggerLocked(config, false)
+		}
+		errorFunc(err)
+	}
+	config, err := newDefaultConfiguration()
+	if err != nil {
+		return err
+	}
+	return initLoggerLocked(config, true)
 }
 
 func pushLogMessageToChannel(lm logMessage) {
-	if vloggerInstance != nil {
-		if lm.level >= vloggerInstance.minLevel && lm.level <= vloggerInstance.maxLevel {
-			logMessages <- lm
+	log := getLogger()
+	if log == nil {
+		vlogStats.dropped.Add(1)
+		return
+	}
+	if log.isLevelAllowed(lm.level, lm.context) {
+		vlogStats.messageCounter(lm.level).Add(1)
+		if !log.send(lm) {
+			vlogStats.dropped.Add(1)
 		}
-	} else {
-		panicLoggerInstanceNotBeCreated()
 	}
 }
 
-func dispatch(lm logMessage) {
-	vloggerInstance.disp.Dispatch(lm.message, lm.level, lm.context, errorFunc)
+// 发送消息到messages，logger已关闭时返回false
+func (log *logger) send(lm logMessage) bool {
+	log.sendLock.RLock()
+	defer log.sendLock.RUnlock()
+	if log.isStopped {
+		return false
+	}
+	log.messages <- lm
+	return true
 }
 
-func dispatchLogMessage() {
+func (log *logger) dispatch(lm logMessage) {
+	if lm.flushDone != nil {
+		log.disp.Flush(lm.flushDone)
+		return
+	}
+	atomic.AddInt32(&log.inFlight, 1)
+	defer atomic.AddInt32(&log.inFlight, -1)
+	if atomic.LoadInt32(&log.isAbandoned) != 0 {
+		vlogStats.dropped.Add(1)
+		return
+	}
+	log.disp.Dispatch(lm.message, lm.level, lm.context, errorFunc)
+}
+
+func (log *logger) dispatchLogMessage() {
 	//另一种方式
 	//for {
 	//	fmt.Println("等待日志消息....")
@@ -70,54 +178,140 @@ func dispatchLogMessage() {
 	//	}
 	//}
 	for {
-		if lm, ok := <-logMessages; ok {
-			dispatch(lm)
+		if lm, ok := <-log.messages; ok {
+			log.dispatch(lm)
 		} else {
 			break
 		}
 	}
-	dispatcherClose()
-}
-
-func panicLoggerInstanceNotBeCreated() {
-	panic("vlogger instance not be created, please call InitLoggerWithFile(fileName)")
+	log.dispatcherClose()
+	close(log.stopped)
 }
 
-func errorFunc(err error) {
-	fmt.Println("vlog error:", err.Error())
-}
-
-func dispatcherClose() {
-	vloggerInstance.lock.Lock()
-	defer vloggerInstance.lock.Unlock()
-	if !vloggerInstance.isClosed {
-		err := vloggerInstance.disp.Close()
+func (log *logger) dispatcherClose() {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	if !log.isClosed {
+		err := log.disp.Close()
 		if err != nil {
 			errorFunc(err)
 		}
-		vloggerInstance.isClosed = true
+		log.isClosed = true
 	}
 }
 
 //==============================================================================
 
+// Initializes the logger with the configuration file, the VLOG_CONFIG
+// environment variable takes precedence over fileName.
 func InitLoggerWithFile(fileName string) (err error) {
+	if envFileName := os.Getenv(EnvConfig); envFileName != "" {
+		fileName = envFileName
+	}
 	var config *configuration
 	config, err = loadConfigurationFromFile(fileName)
 	if err != nil {
 		return err
 	}
-	vloggerInstance, err = getLoggerInstance(config)
+	return initLogger(config)
+}
+
+// Initializes the logger with a configuration read from reader,
+// format is one of ConfigFormatXML, ConfigFormatJSON, ConfigFormatYAML, ConfigFormatTOML.
+// InitLoggerWithFile chooses the format by the file extension.
+func InitLoggerWithReader(reader io.Reader, format string) (err error) {
+	var config *configuration
+	config, err = loadConfiguration(reader, format, "reader")
 	if err != nil {
 		return err
 	}
-		
-	logMessages = make(chan logMessage, 100)
-	vloggerInstance.start()
-	
+	return initLogger(config)
+}
+
+// Initializes the logger with a configuration created by NewConfig().
+func InitLogger(config *Config) error {
+	if config == nil || config.config == nil {
+		return errors.New("config can not be nil, please create it by NewConfig().Build()")
+	}
+	return initLogger(config.config)
+}
+
+// Initializes the logger with the default configuration: a console outputter
+// using DefaultMsgFormat, minlevel info. VLOG_MINLEVEL and VLOG_MAXLEVEL override the levels.
+// Logging before any initialization does this implicitly, or loads VLOG_CONFIG if it is set.
+func InitDefault() error {
+	config, err := newDefaultConfiguration()
+	if err != nil {
+		return err
+	}
+	initLock.Lock()
+	defer initLock.Unlock()
+	return initLoggerLocked(config, true)
+}
+
+func newDefaultConfiguration() (*configuration, error) {
+	model := &configModel{
+		MinLevel:   "info",
+		Outputters: outputterModels{{Type: "console", FormatterID: "default"}},
+		Formatters: []*formatterModel{{ID: "default", Format: configValue(DefaultMsgFormat)}},
+	}
+	applyConfigEnv(model)
+	return newConfigurationFromModel(model)
+}
+
+func initLogger(config *configuration) (err error) {
+	initLock.Lock()
+	defer initLock.Unlock()
+	return initLoggerLocked(config, false)
+}
+
+func initLoggerLocked(config *configuration, isDefault bool) (err error) {
+	log, err := getLoggerInstance(config)
+	if err != nil {
+		closeFormattedWriters(config.writers)
+		return err
+	}
+	runtimeErrorLogFileName = config.runtimeErrorLogFileName
+	runtimeErrorLogPermissions = config.permissions
+	log.isDefault = isDefault
+
+	previous := vloggerInstance.Load()
+	log.messages = make(chan logMessage, 100)
+	log.start()
+	vloggerInstance.Store(log)
+	publishExpvar()
+
+	//之前的logger（包括默认logger）中已有的消息写入后将其关闭，释放打开的文件
+	if previous != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+		defer cancel()
+		lost, err := previous.shutdown(ctx)
+		if err != nil {
+			errorFunc(fmt.Errorf("vlog close previous logger error: %d messages lost: %v", lost, err))
+		}
+	}
 	return nil
 }
 
+// Logs at the given level, which is a built-in level or one registered by RegisterLevel.
+func Log(level LogLevel, params ...interface{}) {
+	newLogMessage(level, params)
+}
+
+func Logf(level LogLevel, fmtString string, params ...interface{}) {
+	newFormatLogMessage(level, fmtString, params)
+}
+
+// Logs a business-critical event at LvImportant, which is not limited by
+// minlevel, maxlevel and exceptions. Route it with levels="important".
+func Important(params ...interface{}) {
+	newLogMessage(LvImportant, params)
+}
+
+func Importantf(fmtString string, params ...interface{}) {
+	newFormatLogMessage(LvImportant, fmtString, params)
+}
+
 func Trace(params ...interface{}) {
 	newLogMessage(LvTrace, params)
 }
@@ -171,8 +365,12 @@ func writeRuntimeError(err error) {
 	//不存在，则创建
 	//存在，则打开附加写入
 	logStr := fmt.Sprintf("%v: vlog runtime error %v\n", time.Now(), err)
-	fileWriter, err := os.OpenFile(RUNTIME_ERROR_LOG_FILENAME,
-		os.O_WRONLY|os.O_APPEND|os.O_CREATE, defaultFilePermissions)
+	fileName := runtimeErrorLogFileName
+	if fileName == "" {
+		fileName = RUNTIME_ERROR_LOG_FILENAME
+	}
+	fileWriter, err := runtimeErrorLogPermissions.openFile(fileName,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE)
 	if err != nil {
 		fmt.Print(logStr)
 		return
@@ -185,15 +383,62 @@ func writeRuntimeError(err error) {
 	}
 }
 
+// Blocks until every message logged before the call has been written
+// and the buffers of all outputters have been flushed, or ctx is done.
+func Flush(ctx context.Context) error {
+	log := vloggerInstance.Load()
+	if log == nil {
+		//尚未记录过日志
+		return nil
+	}
+	done := make(chan struct{})
+	if !log.send(logMessage{flushDone: done}) {
+		return ErrLoggerClosed
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stops accepting new messages, writes the queued ones and closes all outputters.
+// If ctx is done first, the messages not written yet are discarded and counted in lost.
+// Messages logged after Shutdown are dropped.
+func Shutdown(ctx context.Context) (lost int, err error) {
+	log := vloggerInstance.Load()
+	if log == nil {
+		return 0, nil
+	}
+	return log.shutdown(ctx)
+}
+
+func (log *logger) shutdown(ctx context.Context) (lost int, err error) {
+	log.sendLock.Lock()
+	if !log.isStopped {
+		log.isStopped = true
+		close(log.messages)
+	}
+	log.sendLock.Unlock()
+
+	select {
+	case <-log.stopped:
+		return 0, nil
+	case <-ctx.Done():
+		lost = len(log.messages) + int(atomic.LoadInt32(&log.inFlight)) + log.disp.queuedCount()
+		atomic.StoreInt32(&log.isAbandoned, 1)
+		log.disp.abandon()
+		return lost, ctx.Err()
+	}
+}
+
+// Shutdown with DefaultShutdownTimeout, lost messages are reported to the error handler.
 func Close() {
-	for {
-		select {
-		case lm := <-logMessages:
-			dispatch(lm)
-		case <-time.After(5 * time.Second):
-			close(logMessages)
-			dispatcherClose()
-			return
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	lost, err := Shutdown(ctx)
+	if err != nil {
+		errorFunc(fmt.Errorf("vlog close error: %d messages lost: %v", lost, err))
 	}
 }
\ No newline at end of file
@@ -8,11 +8,22 @@ type logMessage struct {
 	level   LogLevel
 	message string
 	context runtimeContextInterface
+	//不为nil时表示Flush请求，消息之前的日志全部写入后关闭
+	flushDone chan struct{}
 }
 
+// Structured fields of a log message, passed among the params of the log functions:
+//
+//	vlog.Info("order paid", vlog.Fields{"user": "alice", "amount": 100})
+//
+// They are not part of the message, but can be written by the %fields tag and matched by filters.
+type Fields map[string]interface{}
+
 func newLogMessage(level LogLevel, params []interface{}) {
-	context, err := specificContext(2)
+	params, fields := splitFields(params)
+	context, err := newMessageContext(params, fields)
 	if err != nil {
+		vlogStats.dropped.Add(1)
 		errorFunc(err)
 		return
 	}
@@ -24,8 +35,10 @@ func newLogMessage(level LogLevel, params []interface{}) {
 }
 
 func newFormatLogMessage(level LogLevel, fmtString string, params []interface{}) {
-	context, err := specificContext(2)
+	params, fields := splitFields(params)
+	context, err := newMessageContext(params, fields)
 	if err != nil {
+		vlogStats.dropped.Add(1)
 		errorFunc(err)
 		return
 	}
@@ -34,4 +47,50 @@ func newFormatLogMessage(level LogLevel, fmtString string, params []interface{})
 	message.message = fmt.Sprintf(fmtString, params...)
 	message.context = context
 	pushLogMessageToChannel(message)
-}
\ No newline at end of file
+}
+
+// 从日志参数中分离出Fields，多个Fields合并
+func splitFields(params []interface{}) ([]interface{}, Fields) {
+	var fields Fields
+	for i, param := range params {
+		if _, ok := param.(Fields); !ok {
+			continue
+		}
+		rest := make([]interface{}, 0, len(params))
+		rest = append(rest, params[:i]...)
+		fields = make(Fields)
+		for _, param := range params[i:] {
+			if f, ok := param.(Fields); ok {
+				for k, v := range f {
+					fields[k] = v
+				}
+				continue
+			}
+			rest = append(rest, param)
+		}
+		return rest, fields
+	}
+	return params, nil
+}
+
+//获取日志调用者的上下文，并记录日志参数中的第一个error，供%err使用
+func newMessageContext(params []interface{}, fields Fields) (runtimeContextInterface, error) {
+	stackDepth := 0
+	if log := getLogger(); log != nil {
+		stackDepth = log.stackDepth
+	}
+	context, err := specificContextWithStack(3, stackDepth)
+	if err != nil {
+		return context, err
+	}
+	if lc, ok := context.(*logContext); ok {
+		lc.fields = fields
+		for _, param := range params {
+			if e, ok := param.(error); ok {
+				lc.err = e
+				break
+			}
+		}
+	}
+	return context, nil
+}
@@ -0,0 +1,149 @@
+package vlog
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultAsyncQueueSize = 1000
+
+// 异步队列的最大消息条数，避免过大的queuesize在加载配置时占用大量内存
+const MaxAsyncQueueSize = 1 << 20
+
+// 异步队列满时的处理方式
+const (
+	overflowBlock      = "block"      //等待队列有空位，默认
+	overflowDrop       = "drop"       //丢弃新消息
+	overflowDropOldest = "dropoldest" //丢弃队列中最早的消息
+)
+
+// asyncQueue为单个outputter提供独立的goroutine和有界队列，
+// 使慢的outputter（数据库、网络）不会拖慢其他outputter。
+type asyncQueue struct {
+	lock     sync.Mutex
+	messages chan logMessage
+	overflow string
+	isClosed bool
+	done     chan struct{}
+	//不为零时丢弃剩余的消息
+	isAbandoned int32
+	//写入goroutine已取出、尚未写完的消息数
+	inFlight int32
+}
+
+func newAsyncQueue(queueSize int, overflow string) (queue *asyncQueue, err error) {
+	switch overflow {
+	case "":
+		overflow = overflowBlock
+	case overflowBlock, overflowDrop, overflowDropOldest:
+	default:
+		return nil, errors.New("overflow value is illegal: " + overflow)
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultAsyncQueueSize
+	}
+	if queueSize > MaxAsyncQueueSize {
+		return nil, errors.New("queuesize value is illegal: " + strconv.Itoa(queueSize) +
+			" is larger than " + strconv.Itoa(MaxAsyncQueueSize) + ".")
+	}
+	queue = new(asyncQueue)
+	queue.messages = make(chan logMessage, queueSize)
+	queue.overflow = overflow
+	queue.done = make(chan struct{})
+	return queue, nil
+}
+
+// 启动写入goroutine
+func (queue *asyncQueue) start(writer *formattedWriter) {
+	go func() {
+		for lm := range queue.messages {
+			if lm.flushDone != nil {
+				flushAndRecord(writer)
+				close(lm.flushDone)
+				continue
+			}
+			if atomic.LoadInt32(&queue.isAbandoned) != 0 {
+				vlogStats.dropped.Add(1)
+				continue
+			}
+			atomic.AddInt32(&queue.inFlight, 1)
+			writeAndRecord(writer, lm.message, lm.level, lm.context)
+			atomic.AddInt32(&queue.inFlight, -1)
+		}
+		close(queue.done)
+	}()
+}
+
+func (queue *asyncQueue) push(lm logMessage) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.isClosed {
+		if lm.flushDone != nil {
+			close(lm.flushDone)
+		} else {
+			vlogStats.dropped.Add(1)
+		}
+		return
+	}
+	overflow := queue.overflow
+	if lm.flushDone != nil {
+		//Flush请求不能丢弃
+		overflow = overflowBlock
+	}
+	switch overflow {
+	case overflowDrop:
+		select {
+		case queue.messages <- lm:
+		default:
+			vlogStats.dropped.Add(1)
+		}
+	case overflowDropOldest:
+		for {
+			select {
+			case queue.messages <- lm:
+				return
+			default:
+			}
+			select {
+			case oldest := <-queue.messages:
+				if oldest.flushDone != nil {
+					//不能让Flush一直等待
+					close(oldest.flushDone)
+				} else {
+					vlogStats.dropped.Add(1)
+				}
+			default:
+			}
+		}
+	default:
+		queue.messages <- lm
+	}
+}
+
+// 关闭队列，并等待队列中的消息全部写入
+func (queue *asyncQueue) close() {
+	queue.lock.Lock()
+	if queue.isClosed {
+		queue.lock.Unlock()
+		return
+	}
+	queue.isClosed = true
+	close(queue.messages)
+	queue.lock.Unlock()
+	<-queue.done
+}
+
+func (queue *asyncQueue) abandon() {
+	atomic.StoreInt32(&queue.isAbandoned, 1)
+}
+
+func (queue *asyncQueue) length() int {
+	return len(queue.messages)
+}
+
+// 尚未写完的消息数，包括正在写入的消息
+func (queue *asyncQueue) pending() int {
+	return len(queue.messages) + int(atomic.LoadInt32(&queue.inFlight))
+}
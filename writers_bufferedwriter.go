@@ -0,0 +1,152 @@
+package vlog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"time"
+)
+
+// The fsync attribute values of file and rulefile elements.
+const (
+	FsyncNever    = "never"    //不主动同步到磁盘（vlog.Flush除外），默认
+	FsyncRotation = "rotation" //文件轮转和关闭时同步
+	FsyncInterval = "interval" //每flushinterval同步一次，轮转和关闭时同步
+	FsyncAlways   = "always"   //每次写入后同步，缓冲不再起作用
+)
+
+// buffersize大于零而未设置flushinterval时，缓冲中的数据最多等待的时间
+var DefaultFlushInterval = time.Second
+
+// file、rulefile的缓冲、刷新和fsync策略，零值为不缓冲、不同步
+type fileFlushPolicy struct {
+	bufferSize    int           //缓冲字节数，0表示不缓冲
+	flushInterval time.Duration //0表示使用DefaultFlushInterval
+	fsync         string
+}
+
+func newFileFlushPolicy(bufferSize int, flushInterval time.Duration, fsync string) (policy fileFlushPolicy, err error) {
+	if bufferSize < 0 {
+		return policy, errors.New("buffersize value can not be negative.")
+	}
+	if flushInterval < 0 {
+		return policy, errors.New("flushinterval value can not be negative.")
+	}
+	switch fsync {
+	case "":
+		fsync = FsyncNever
+	case FsyncNever, FsyncRotation, FsyncInterval, FsyncAlways:
+	default:
+		return policy, errors.New("fsync value is illegal: " + fsync + ", it must be never, rotation, interval or always.")
+	}
+	return fileFlushPolicy{bufferSize, flushInterval, fsync}, nil
+}
+
+func (policy fileFlushPolicy) interval() time.Duration {
+	if policy.flushInterval > 0 {
+		return policy.flushInterval
+	}
+	return DefaultFlushInterval
+}
+
+// 为file或rulefile outputter设置缓冲和fsync策略
+func enableFlushPolicy(name string, writer *formattedWriter, policy fileFlushPolicy) error {
+	switch w := writer.writer.(type) {
+	case *fileWriter:
+		w.policy = policy
+	case *ruleFileWriter:
+		w.policy = policy
+	default:
+		return errors.New(name + " does not support the buffersize, flushinterval and fsync attributes.")
+	}
+	return nil
+}
+
+// 带缓冲的日志文件，关闭时写入缓冲中的数据
+type bufferedWriter struct {
+	*bufio.Writer
+	file io.WriteCloser //*os.File或*encryptedWriter
+}
+
+func newBufferedWriter(file io.WriteCloser, size int) *bufferedWriter {
+	return &bufferedWriter{bufio.NewWriterSize(file, size), file}
+}
+
+func (writer *bufferedWriter) Sync() error {
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+	if f, ok := writer.file.(interface{ Sync() error }); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
+func (writer *bufferedWriter) Close() error {
+	err := writer.Flush()
+	closeErr := writer.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// 在每次写入之后调用，调用者须持有lock
+func (writer *fileWriter) applyFlushPolicy() error {
+	if writer.policy.fsync == FsyncAlways {
+		return writer.flushInnerWriter(true)
+	}
+	_, isBuffered := writer.innerWriter.(*bufferedWriter)
+	if (isBuffered || writer.policy.fsync == FsyncInterval) && writer.flushTimer == nil {
+		writer.flushTimer = time.AfterFunc(writer.policy.interval(), writer.timedFlush)
+	}
+	return nil
+}
+
+func (writer *fileWriter) timedFlush() {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	writer.flushTimer = nil
+	if writer.innerWriter == nil {
+		return
+	}
+	err := writer.flushInnerWriter(writer.policy.fsync == FsyncInterval)
+	if err != nil {
+		errorFunc(errors.New("vlog flush " + writer.currentStorageFileName + " error: " + err.Error()))
+	}
+}
+
+// 写入缓冲中的数据，isSync为true时同步到磁盘，调用者须持有lock
+func (writer *fileWriter) flushInnerWriter(isSync bool) error {
+	if isSync {
+		if f, ok := writer.innerWriter.(interface{ Sync() error }); ok {
+			return f.Sync()
+		}
+		return nil
+	}
+	if b, ok := writer.innerWriter.(*bufferedWriter); ok {
+		return b.Flush()
+	}
+	return nil
+}
+
+// 写入error及以上等级的消息后调用，不必等待flushinterval
+type bufferFlusher interface {
+	flushBuffer() error
+}
+
+func (writer *fileWriter) flushBuffer() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	return writer.flushInnerWriter(false)
+}
+
+func (writer *ruleFileWriter) flushBuffer() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	if fWriter, ok := writer.fileWriters[writer.fileName]; ok {
+		return fWriter.flushBuffer()
+	}
+	return nil
+}
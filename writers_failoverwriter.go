@@ -0,0 +1,153 @@
+package vlog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultFailoverRetryInterval = time.Second * 30
+
+// failoverWriter依次尝试写入各子outputter，直到有一个写入成功。
+// 当前使用的子outputter出错时切换到下一个，每隔retryInterval重新尝试第一个（主outputter）。
+type failoverWriter struct {
+	lock          sync.Mutex
+	writers       []*formattedWriter //按优先级排列的子outputter
+	current       int                //当前使用的子outputter下标
+	retryInterval time.Duration      //切换到备用outputter后重试主outputter的间隔
+	lastRetryTime time.Time
+}
+
+func newFailoverWriter(writers []*formattedWriter, retryInterval time.Duration) (writer *failoverWriter, err error) {
+	if len(writers) == 0 {
+		return nil, errors.New("failover element must have one child element at least.")
+	}
+	writer = new(failoverWriter)
+	writer.writers = writers
+	if retryInterval > 0 {
+		writer.retryInterval = retryInterval
+	} else {
+		writer.retryInterval = DefaultFailoverRetryInterval
+	}
+	return writer, nil
+}
+
+// 子outputter各自格式化消息，因此不支持直接写入字节
+func (writer *failoverWriter) Write(bytes []byte) (int, error) {
+	return 0, errors.New("failoverWriter does not support writing formatted bytes")
+}
+
+func (writer *failoverWriter) writeMessage(message string, level LogLevel, context runtimeContextInterface) error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	start := writer.current
+	if start > 0 && time.Since(writer.lastRetryTime) >= writer.retryInterval {
+		//重试主outputter
+		writer.lastRetryTime = time.Now()
+		start = 0
+	}
+	errMsg := ""
+	var currentErr error
+	for i := start; i < len(writer.writers); i++ {
+		child := writer.writers[i]
+		begin := time.Now()
+		err := child.Write(message, level, context)
+		child.stats.record(time.Since(begin), err)
+		if err == nil {
+			if i != writer.current {
+				if currentErr != nil {
+					//消息已写入备用outputter，当前outputter的错误只在此报告一次
+					current := writer.writers[writer.current]
+					errorFunc(WriterError{current.writerType, current.formatter.id, message, level, currentErr})
+				}
+				writer.switchTo(i, currentErr)
+			}
+			return nil
+		}
+		if i == writer.current {
+			currentErr = err
+		}
+		errMsg += err.Error() + ","
+	}
+	//全部失败时只返回汇总的错误，由调用者报告
+	return errors.New("all failover outputters failed: " + errMsg[:len(errMsg)-1])
+}
+
+// 切换当前使用的子outputter，并将切换记录写入新的outputter
+func (writer *failoverWriter) switchTo(index int, cause error) {
+	from := writer.writers[writer.current]
+	to := writer.writers[index]
+	writer.current = index
+	if index == 0 {
+		writer.lastRetryTime = time.Time{}
+	} else {
+		writer.lastRetryTime = time.Now()
+	}
+
+	stateMsg := "vlog failover: switched from " + from.writerType + "(formatter " + from.formatter.id +
+		") to " + to.writerType + "(formatter " + to.formatter.id + ")"
+	if cause != nil {
+		stateMsg += ": " + cause.Error()
+	}
+	context, _ := specificContext(0)
+	err := to.write(stateMsg, LvWarn, context)
+	if err != nil {
+		errorFunc(WriterError{to.writerType, to.formatter.id, stateMsg, LvWarn, err})
+	}
+}
+
+// 返回所有formatter中%stack要求的最大调用栈层数
+func (writer *failoverWriter) stackDepth() int {
+	depth := 0
+	for _, child := range writer.writers {
+		if child.formatter.stackDepth > depth {
+			depth = child.formatter.stackDepth
+		}
+	}
+	return depth
+}
+
+func (writer *failoverWriter) Flush() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	errMsg := ""
+	for _, child := range writer.writers {
+		err := child.Flush()
+		if err != nil {
+			errMsg += err.Error() + ","
+		}
+	}
+	if errMsg != "" {
+		return errors.New("some failover outputter flushed error: " + errMsg[:len(errMsg)-1])
+	}
+	return nil
+}
+
+func (writer *failoverWriter) Close() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	errMsg := ""
+	for _, child := range writer.writers {
+		err := child.Close()
+		if err != nil {
+			errMsg += err.Error() + ","
+		}
+	}
+	if errMsg != "" {
+		return errors.New("some failover outputter closed error: " + errMsg[:len(errMsg)-1])
+	}
+	return nil
+}
+
+func (writer *failoverWriter) String() string {
+	children := make([]string, len(writer.writers))
+	for i, child := range writer.writers {
+		children[i] = fmt.Sprint(child)
+	}
+	return "failoverWriter: current=" + fmt.Sprint(writer.current) +
+		", retryInterval=" + fmt.Sprint(writer.retryInterval) +
+		", writers=[" + strings.Join(children, "; ") + "]"
+}
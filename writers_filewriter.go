@@ -2,6 +2,7 @@ package vlog
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"errors"
 	"fmt"
 	"io"
@@ -48,18 +49,32 @@ type fileWriter struct {
 	currentCountNumber          int    //当前自动编号计数器
 	lastWriteTime               time.Time
 	isNeedAutoFreeOpenedFile    bool
+	maxIdleTime                 time.Duration //文件空闲多久后关闭，见idletimeout属性
 	lastAutoFreeOpenedFileTimer *time.Timer
+	rotations                   *counter //文件轮转次数，ruleFileWriter中的fileWriter共用同一个计数器
+	chain                       *hashChain //不为nil时为每条记录追加链式哈希，见IntegritySHA256Chain
+	aead                        cipher.AEAD //不为nil时加密写入，见EncryptAESGCM
+	policy                      fileFlushPolicy //缓冲、刷新和fsync策略
+	flushTimer                  *time.Timer     //缓冲中有数据或等待fsync时不为nil
+	isReopenOnMove              bool            //文件被移走或删除时重新创建
+	openedFile                  os.FileInfo     //打开的文件，用于检测文件是否被移走
+	lastMoveCheckTime           time.Time
+	symlink                     string //不为空时打开文件后使此符号链接指向当前文件
+	lockFile                    *fileLock //不为nil时与其他进程共享日志文件，见lockfile属性
+	perm                        filePermissions //创建的文件和目录的权限及属组
 }
 
 func newFileWriter(fileName string, allowedMaxSize int64, isNeedAutoFreeOpenedFile bool) (writer *fileWriter, err error) {
 	writer = new(fileWriter)
-	writer.fileName = fileName
+	writer.fileName = expandPid(fileName)
 	if allowedMaxSize > 0 {
 		writer.allowedMaxFileSize = allowedMaxSize
 	} else {
 		writer.allowedMaxFileSize = DefaultAllowedFileMaxSize
 	}
 	writer.isNeedAutoFreeOpenedFile = isNeedAutoFreeOpenedFile
+	writer.maxIdleTime = DefaultOpenedFileMaxIdleTime
+	writer.rotations = new(counter)
 	
 	fileExtName := filepath.Ext(writer.fileName)
 
@@ -75,41 +90,145 @@ func newFileWriter(fileName string, allowedMaxSize int64, isNeedAutoFreeOpenedFi
 		writer.fileSuffixName = writer.fileName[autoIncrementSymbolIndexs[1]:]
 	}
 
-	if strings.ContainsRune(writer.fileSuffixName, os.PathSeparator) {
-		return nil, errors.New("folder can not be auto increment")
+	if err = checkAutoIncrementSuffix(writer.fileSuffixName); err != nil {
+		return nil, err
 	}
 	writer.filePrefixName = filepath.Base(writer.filePrefixName)
 	return writer, nil
 }
 
+// 检查file的filename，不创建fileWriter，供Validate使用
+func checkFileName(fileName string) error {
+	fileName = expandPid(fileName)
+	indexs := autoIncrementReg.FindStringIndex(fileName)
+	if len(indexs) == 0 {
+		return nil
+	}
+	return checkAutoIncrementSuffix(fileName[indexs[1]:])
+}
+
+// 自动编号符号只能出现在文件名中
+func checkAutoIncrementSuffix(fileSuffixName string) error {
+	if strings.ContainsRune(fileSuffixName, os.PathSeparator) {
+		return errors.New("folder can not be auto increment")
+	}
+	return nil
+}
+
+// file的filename只支持%pid一个标签，在创建时替换
+func expandPid(fileName string) string {
+	return strings.Replace(fileName, "%pid", processID, -1)
+}
+
 func (writer *fileWriter) Close() error {
 	writer.lock.Lock()
 	defer writer.lock.Unlock()
+	if writer.lastAutoFreeOpenedFileTimer != nil {
+		writer.lastAutoFreeOpenedFileTimer.Stop()
+		writer.lastAutoFreeOpenedFileTimer = nil
+	}
+	if writer.lockFile != nil {
+		writer.lockFile.close()
+	}
+	return writer.close()
+}
+
+// 调用者须持有lock，关闭时写入缓冲中的数据
+func (writer *fileWriter) close() error {
+	if writer.flushTimer != nil {
+		writer.flushTimer.Stop()
+		writer.flushTimer = nil
+	}
 	if writer.innerWriter != nil {
+		var checkpointErr error
+		if writer.chain != nil && writer.chain.isDirty {
+			//关闭或轮转前签名已写入的记录
+			_, checkpointErr = writer.innerWriter.Write(writer.chain.checkpoint(time.Now()))
+			if checkpointErr == nil {
+				writer.chain.isDirty = false
+			}
+		}
+		if checkpointErr == nil && writer.policy.fsync != FsyncNever {
+			//轮转或关闭前同步到磁盘
+			checkpointErr = writer.flushInnerWriter(true)
+		}
 		err := writer.innerWriter.Close()
 		writer.innerWriter = nil
+		writer.openedFile = nil
+		if err == nil {
+			err = checkpointErr
+		}
 		return err
 	}
 	return nil
 }
 
+// 将已写入的内容同步到磁盘
+func (writer *fileWriter) Flush() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	if f, ok := writer.innerWriter.(interface{ Sync() error }); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
 func (writer *fileWriter) autoFreeOpenedFile() {
-	if writer.innerWriter != nil {
-		nowTime := time.Now()
-		expiredTime := writer.lastWriteTime.Add(DefaultOpenedFileMaxIdleTime)
-		if nowTime.After(expiredTime) {
-			//已过期，清理
-			writer.Close()
-		} else {
-			//未过期，等会儿再检查
-			writer.lastAutoFreeOpenedFileTimer = time.AfterFunc(DefaultOpenedFileMaxIdleTime,
-				writer.autoFreeOpenedFile)
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	writer.lastAutoFreeOpenedFileTimer = nil
+	if writer.innerWriter == nil {
+		//已关闭，下次打开文件时再开启
+		return
+	}
+	idleTime := time.Since(writer.lastWriteTime)
+	if idleTime >= writer.maxIdleTime {
+		//已过期，清理，缓冲中的数据在关闭时写入
+		if writer.lockFile != nil {
+			writer.lockFile.close()
+		}
+		if err := writer.close(); err != nil {
+			errorFunc(errors.New("vlog close idle " + writer.currentStorageFileName + " error: " + err.Error()))
 		}
+	} else {
+		//未过期，等会儿再检查
+		writer.lastAutoFreeOpenedFileTimer = time.AfterFunc(writer.maxIdleTime-idleTime,
+			writer.autoFreeOpenedFile)
 	}
 }
 
+// 距最后一次写入的时间
+func (writer *fileWriter) idleTime(now time.Time) time.Duration {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	return now.Sub(writer.lastWriteTime)
+}
+
 func (writer *fileWriter) Write(bytes []byte) (n int, err error) {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	n, err = writer.write(bytes)
+	if err == nil && writer.innerWriter != nil {
+		err = writer.applyFlushPolicy()
+	}
+	return n, err
+}
+
+func (writer *fileWriter) write(bytes []byte) (n int, err error) {
+	if writer.isReopenOnMove {
+		//旧文件关闭失败时仍写入新文件
+		if err = writer.checkMoved(); err != nil {
+			errorFunc(err)
+		}
+	}
 	writer.lastWriteTime = time.Now()
+	if writer.lockFile != nil {
+		//编号分配、轮转和写入都在flock保护下进行
+		if err = writer.lockFile.lock(); err != nil {
+			return 0, err
+		}
+		defer writer.lockFile.unlock()
+	}
 	//第一次写入数据
 	if writer.currentStorageFileName == "" {
 		//创建目录和文件
@@ -118,20 +237,34 @@ func (writer *fileWriter) Write(bytes []byte) (n int, err error) {
 			return 0, err
 		}
 	}
+	if writer.lockFile != nil {
+		if err = writer.syncWithLockFile(); err != nil {
+			return 0, err
+		}
+	}
 
 	//超过允许的大小，需新建文件
 	if writer.currentFileSize >= writer.allowedMaxFileSize {
-		writer.Close()
+		writer.close()
 		writer.currentStorageFileName = writer.nextStorageFileName()
+		writer.rotations.Add(1)
+		if writer.lockFile != nil {
+			if err = writer.lockFile.writeNumber(writer.currentCountNumber); err != nil {
+				return 0, err
+			}
+		}
 	}
 	
 	if writer.innerWriter == nil {
 		writer.innerWriter, err = writer.newInnerWriter()
 		if err != nil {
-			return 0, nil
+			return 0, err
 		}
 	}
 
+	if writer.chain != nil {
+		return writer.writeChained(bytes)
+	}
 	n, err = writer.innerWriter.Write(bytes)
 	if err == nil {
 		//只在写入成功的情况下才累加字节数
@@ -154,7 +287,7 @@ func (writer *fileWriter) loadOrCreateStorageFileAndInitSomeAttributes() error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			//日志目录不存在，则创建目录
-			err = os.MkdirAll(folder, defaultDirectoryPermissions)
+			err = writer.perm.mkdirAll(folder)
 			if err != nil {
 				return err
 			}
@@ -219,7 +352,11 @@ func (writer *fileWriter) getStorageFileName() (storageFileName string, err erro
 }
 
 func (writer *fileWriter) getCountNumberSign() (sign string) {
-	sign = strconv.Itoa(writer.currentCountNumber)
+	return writer.countNumberSign(writer.currentCountNumber)
+}
+
+func (writer *fileWriter) countNumberSign(number int) (sign string) {
+	sign = strconv.Itoa(number)
 	length := len(sign)
 	buf := bytes.NewBufferString("")
 	for i := 0; i < writer.autoIncrementNumDigit-length; i++ {
@@ -232,21 +369,72 @@ func (writer *fileWriter) getCountNumberSign() (sign string) {
 
 func (writer *fileWriter) newInnerWriter() (innerWriter io.WriteCloser, err error) {
 	//打开日志文件，不存在则创建
-	innerWriter, err = os.OpenFile(writer.currentStorageFileName, 
-		os.O_WRONLY|os.O_APPEND|os.O_CREATE, defaultFilePermissions)
+	file, err := writer.perm.openFile(writer.currentStorageFileName,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE)
 	if err == nil {
+		innerWriter = file
+		if writer.symlink != "" {
+			//符号链接只为方便查看，失败时仍写入日志
+			if linkErr := updateSymlink(writer.symlink, writer.currentStorageFileName, writer.perm); linkErr != nil {
+				errorFunc(errors.New("vlog symlink " + writer.symlink + " error: " + linkErr.Error()))
+			}
+		}
+		if writer.isReopenOnMove {
+			writer.openedFile, _ = file.Stat()
+			writer.lastMoveCheckTime = time.Now()
+		}
+		if writer.aead != nil {
+			innerWriter = &encryptedWriter{file, writer.aead, &writer.currentFileSize}
+		}
+		if writer.policy.bufferSize > 0 {
+			innerWriter = newBufferedWriter(innerWriter, writer.policy.bufferSize)
+		}
 		writer.lastWriteTime = time.Now()
 		
-		if writer.isNeedAutoFreeOpenedFile {
-			if writer.lastAutoFreeOpenedFileTimer != nil {
-				writer.lastAutoFreeOpenedFileTimer = time.AfterFunc(DefaultOpenedFileMaxIdleTime,
-					writer.autoFreeOpenedFile)
-			}
+		if writer.isNeedAutoFreeOpenedFile && writer.lastAutoFreeOpenedFileTimer == nil {
+			writer.lastAutoFreeOpenedFileTimer = time.AfterFunc(writer.maxIdleTime,
+				writer.autoFreeOpenedFile)
 		}
 	}
 	return innerWriter, err
 }
 
+// 追加链式哈希后写入，进程启动后第一次写入时从已有的文件中恢复哈希链
+func (writer *fileWriter) writeChained(bytes []byte) (n int, err error) {
+	if !writer.chain.isResumed {
+		fileNames := []string{writer.currentStorageFileName}
+		if writer.currentCountNumber > 0 {
+			fileNames = append(fileNames, writer.storageFileNameByNumber(writer.currentCountNumber-1))
+		}
+		err = writer.chain.resume(fileNames...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if writer.currentFileSize == 0 && writer.chain.isStarted() {
+		//新文件以签名的checkpoint开头，延续上一个文件的哈希链
+		n, err = writer.innerWriter.Write(writer.chain.checkpoint(time.Now()))
+		writer.currentFileSize += int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	line, hash := writer.chain.seal(bytes)
+	n, err = writer.innerWriter.Write(line)
+	writer.currentFileSize += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	writer.chain.commit(hash)
+	writer.lastWriteTime = time.Now()
+	return len(bytes), nil
+}
+
+func (writer *fileWriter) storageFileNameByNumber(number int) string {
+	return writer.currentAbsPath + writer.filePrefixName +
+		writer.countNumberSign(number) + writer.fileSuffixName
+}
+
 func (writer *fileWriter) nextStorageFileName() string {
 	writer.currentCountNumber++
 	writer.currentFileSize = 0
@@ -254,6 +442,10 @@ func (writer *fileWriter) nextStorageFileName() string {
 		writer.getCountNumberSign() + writer.fileSuffixName
 }
 
+func (writer *fileWriter) rotationCount() int64 {
+	return writer.rotations.Load()
+}
+
 func (writer *fileWriter) String() string {
 	return "fileWriter: fileName=" + writer.fileName +
 		", filePrefixName=" + writer.filePrefixName +
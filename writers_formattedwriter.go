@@ -11,6 +11,12 @@ type formattedWriter struct {
 	writer           io.WriteCloser
 	formatter        *formatter //消息格式化器
 	allowedLevelList map[LogLevel]bool
+	filters          []*filter //全部filter都接受的消息才写入
+	writerType       string //outputter类型，对应配置文件中的元素名
+	stats            writerStats
+	async            *asyncQueue //不为nil时在独立的goroutine中写入
+	isAudit          bool        //只写入Audit的记录
+	redactor         *redactor   //格式化前处理敏感数据，nil表示不处理
 }
 
 func newFormattedWriter(writer io.WriteCloser, formatter *formatter,
@@ -23,9 +29,26 @@ func newFormattedWriter(writer io.WriteCloser, formatter *formatter,
 	fmtWriter.writer = writer
 	fmtWriter.formatter = formatter
 	fmtWriter.allowedLevelList = allowedLevelList
+	fmtWriter.writerType = writerTypeName(writer)
 	return fmtWriter, nil
 }
 
+func writerTypeName(writer io.WriteCloser) string {
+	switch writer.(type) {
+	case *fileWriter:
+		return "file"
+	case *ruleFileWriter:
+		return "rulefile"
+	case *consoleWriter:
+		return "console"
+	case *databaseWriter:
+		return "database"
+	case *failoverWriter:
+		return "failover"
+	}
+	return fmt.Sprintf("%T", writer)
+}
+
 func (formattedWriter *formattedWriter) Write(message string, level LogLevel, context runtimeContextInterface)(err error) {
 	defer func() {
 		if e, ok := recover().(error); ok {
@@ -33,20 +56,96 @@ func (formattedWriter *formattedWriter) Write(message string, level LogLevel, co
 			writeRuntimeError(e)
 		}
 	} ()
+	if formattedWriter.isAccepted(message, level, context) {
+		err = formattedWriter.write(message, level, context)
+	}
+	return err
+}
+
+func (formattedWriter *formattedWriter) isAllowed(level LogLevel) bool {
+	if formattedWriter.allowedLevelList == nil {
+		//未配置levels属性
+		return true
+	}
 	isAllowed, ok := formattedWriter.allowedLevelList[level]
-	if isAllowed && ok {
-		str := formattedWriter.formatter.Format(message, level, context)
-		writer := formattedWriter.writer
-		w, ok := writer.(*ruleFileWriter)
-		if ok {
-			w.formatFileName(level, context)
+	return isAllowed && ok
+}
+
+// 检查日志等级和filter
+func (fmtWriter *formattedWriter) isAccepted(message string, level LogLevel, context runtimeContextInterface) bool {
+	if !fmtWriter.isAllowed(level) {
+		return false
+	}
+	if len(fmtWriter.filters) == 0 {
+		return true
+	}
+	record := newRecord(message, level, context)
+	for _, f := range fmtWriter.filters {
+		if !f.accept(record) {
+			return false
 		}
-		_, err = writer.Write([]byte(str))
+	}
+	return true
+}
+
+// 使此outputter在独立的goroutine中异步写入
+func (fmtWriter *formattedWriter) startAsync(queue *asyncQueue) {
+	fmtWriter.async = queue
+	queue.start(fmtWriter)
+}
+
+//不检查日志等级，直接格式化并写入
+func (formattedWriter *formattedWriter) write(message string, level LogLevel, context runtimeContextInterface) (err error) {
+	if formattedWriter.redactor != nil {
+		var ok bool
+		message, context, ok = formattedWriter.redactor.redact(message, context)
+		if !ok {
+			return nil
+		}
+	}
+	return formattedWriter.writeRedacted(message, level, context)
+}
+
+//消息已由redactor处理
+func (formattedWriter *formattedWriter) writeRedacted(message string, level LogLevel, context runtimeContextInterface) (err error) {
+	writer := formattedWriter.writer
+	if w, ok := writer.(*failoverWriter); ok {
+		return w.writeMessage(message, level, context)
+	}
+	str := formattedWriter.formatter.Format(message, level, context)
+	w, ok := writer.(*ruleFileWriter)
+	if ok {
+		w.formatFileName(level, context)
+	}
+	_, err = writer.Write([]byte(str))
+	if f, ok := writer.(bufferFlusher); ok && err == nil && level >= LvError {
+		//错误消息立即写入文件
+		err = f.flushBuffer()
 	}
 	return err
 }
 
+// 返回此outputter需要获取的调用栈层数
+func (fmtWriter *formattedWriter) stackDepth() int {
+	if w, ok := fmtWriter.writer.(*failoverWriter); ok {
+		return w.stackDepth()
+	}
+	return fmtWriter.formatter.stackDepth
+}
+
+// 刷新writer的缓冲，writer不带缓冲时什么也不做
+func (fmtWriter *formattedWriter) Flush() error {
+	if f, ok := fmtWriter.writer.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
 func (fmtWriter *formattedWriter) Close() error {
+	if fmtWriter.async != nil {
+		//先写完队列中剩余的消息
+		fmtWriter.async.close()
+	}
 	if fmtWriter.writer != nil {
 		err := fmtWriter.writer.Close()
 		fmtWriter.writer = nil
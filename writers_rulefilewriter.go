@@ -1,6 +1,7 @@
 package vlog
 
 import (
+	"crypto/cipher"
 	"errors"
 	"fmt"
 	"io"
@@ -18,19 +19,36 @@ type ruleFileWriter struct {
 	fileWriters map[string]*fileWriter
 
 	isNeedAutoFreeOpenedFileWriters    bool
+	maxIdleTime                        time.Duration //fileWriter空闲多久后关闭
 	lastAutoFreeOpenedFileWritersTimer *time.Timer
+	rotations                          counter //所有fileWriter的文件轮转次数
+
+	integrity    string //不为空时每个fileWriter使用各自的哈希链
+	integrityKey []byte
+	aead         cipher.AEAD //不为nil时所有fileWriter加密写入
+	policy       fileFlushPolicy
+	isReopenOnMove bool
+	isLockFile     bool //每个fileWriter使用各自的锁文件
+	perm           filePermissions
+
+	symlinkFormatter *formatter //符号链接名格式化器，nil表示不使用符号链接
+	symlinkName      string     //与fileName同时格式化
 }
 
+// rulefile的filename、symlink属性可以使用的标签
+var fileNameTags = []string{"date", "level", "LV", "lv", "pid"}
+
 func newRuleFileWriter(fileNameOriginal string, maxSize int64) (writer *ruleFileWriter, err error) {
 	writer = new(ruleFileWriter)
 	writer.fileNameFormatter, err = newFormatter(fileNameOriginal,
-		[]string{"date", "level", "LV", "lv"})
+		fileNameTags)
 	if err != nil {
 		return nil, err
 	}
 	writer.allowedMaxFileSize = maxSize
 	//必须为true
 	writer.isNeedAutoFreeOpenedFileWriters = true
+	writer.maxIdleTime = DefaultOpenedFileMaxIdleTime
 	writer.fileWriters = make(map[string]*fileWriter, 0)
 	return writer, nil
 }
@@ -38,30 +56,38 @@ func newRuleFileWriter(fileNameOriginal string, maxSize int64) (writer *ruleFile
 //每次写入前都应调用此方法
 func (writer *ruleFileWriter) formatFileName(level LogLevel, context runtimeContextInterface) {
 	writer.fileName = writer.fileNameFormatter.Format("", level, context)
+	if writer.symlinkFormatter != nil {
+		writer.symlinkName = writer.symlinkFormatter.Format("", level, context)
+	}
 }
 
 func (writer *ruleFileWriter) autoFreeOpenedFileWriters() {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
 	nowTime := time.Now()
 	for fileName, fWriter := range writer.fileWriters {
-		if fWriter == nil || fWriter.innerWriter == nil {
+		if fWriter.idleTime(nowTime) < writer.maxIdleTime {
 			continue
 		}
-		expiredTime := fWriter.lastWriteTime.Add(DefaultOpenedFileMaxIdleTime)
-		if nowTime.After(expiredTime) {
-			writer.closeFileWriter(fileName, fWriter)
+		//无论是否成功关闭，这个fileWriter是不能再使用了（原则）
+		delete(writer.fileWriters, fileName)
+		if err := fWriter.Close(); err != nil {
+			errorFunc(errors.New("vlog close idle " + fileName + " error: " + err.Error()))
 		}
 	}
 
 	//如果已全部清理完毕，则不再检查
 	//直到又一个新的fileWriter作为第一个加入时再次开启
 	if len(writer.fileWriters) != 0 {
-		writer.lastAutoFreeOpenedFileWritersTimer = time.AfterFunc(DefaultOpenedFileMaxIdleTime,
+		writer.lastAutoFreeOpenedFileWritersTimer = time.AfterFunc(writer.maxIdleTime,
 			writer.autoFreeOpenedFileWriters)
 	}
 }
 
 func (writer *ruleFileWriter) Write(bytes []byte) (n int, err error) {
-	
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
 	//用于决定是否需要开启（或重新开启）autoFreeOpenedFileWriter()
 	//innerFileWriterCount为零时开启
 	//当且仅当在空的fileWriters map中新加入一个fileWriter时才开启
@@ -74,6 +100,21 @@ func (writer *ruleFileWriter) Write(bytes []byte) (n int, err error) {
 		if err != nil {
 			return 0, err
 		}
+		fWriter.rotations = &writer.rotations
+		fWriter.aead = writer.aead
+		fWriter.policy = writer.policy
+		fWriter.isReopenOnMove = writer.isReopenOnMove
+		fWriter.symlink = writer.symlinkName
+		fWriter.perm = writer.perm
+		if writer.isLockFile {
+			fWriter.lockFile = newFileLock(fWriter.fileName, writer.perm)
+		}
+		if writer.integrity != "" {
+			fWriter.chain, err = newHashChain(writer.integrity, writer.integrityKey)
+			if err != nil {
+				return 0, err
+			}
+		}
 		writer.fileWriters[writer.fileName] = fWriter
 
 		if writer.isNeedAutoFreeOpenedFileWriters && innerFileWriterCount == 0 {
@@ -84,7 +125,7 @@ func (writer *ruleFileWriter) Write(bytes []byte) (n int, err error) {
 			//	writer.lastAutoFreeOpenedFileWritersTimer.Stop()
 			//}
 			//=====已无必要 end
-			writer.lastAutoFreeOpenedFileWritersTimer = time.AfterFunc(DefaultOpenedFileMaxIdleTime,
+			writer.lastAutoFreeOpenedFileWritersTimer = time.AfterFunc(writer.maxIdleTime,
 				writer.autoFreeOpenedFileWriters)
 		}
 	}
@@ -92,15 +133,19 @@ func (writer *ruleFileWriter) Write(bytes []byte) (n int, err error) {
 	return n, err
 }
 
-func (writer *ruleFileWriter) closeFileWriter(fileName string, fWriter *fileWriter) error {
+func (writer *ruleFileWriter) Flush() error {
 	writer.lock.Lock()
 	defer writer.lock.Unlock()
-	//无论是否成功关闭，这个fileWriter是不能再使用了（原则）
-	delete(writer.fileWriters, fileName)
-	if fWriter.innerWriter != nil {
-		err := fWriter.innerWriter.Close()
-		fWriter.innerWriter = nil
-		return err
+	errMsg := ""
+	for fileName, fileWriter := range writer.fileWriters {
+		err := fileWriter.Flush()
+		if err != nil {
+			errMsg += fileName + " flushed error: " + err.Error() + ","
+		}
+	}
+	if errMsg != "" {
+		return errors.New("some fileWriter flushed error: [" +
+			errMsg[:len(errMsg)-1] + "]")
 	}
 	return nil
 }
@@ -108,11 +153,14 @@ func (writer *ruleFileWriter) closeFileWriter(fileName string, fWriter *fileWrit
 func (writer *ruleFileWriter) Close() (err error) {
 	writer.lock.Lock()
 	defer writer.lock.Unlock()
+	if writer.lastAutoFreeOpenedFileWritersTimer != nil {
+		writer.lastAutoFreeOpenedFileWritersTimer.Stop()
+		writer.lastAutoFreeOpenedFileWritersTimer = nil
+	}
 	errMsg := ""
 	for fileName, fileWriter := range writer.fileWriters {
 		delete(writer.fileWriters, fileName)
-		err := fileWriter.innerWriter.Close()
-		fileWriter.innerWriter = nil
+		err := fileWriter.Close()
 		if err != nil {
 			errMsg += fileName + " closed error: " + err.Error() + ","
 		}
@@ -125,6 +173,10 @@ func (writer *ruleFileWriter) Close() (err error) {
 	return nil
 }
 
+func (writer *ruleFileWriter) rotationCount() int64 {
+	return writer.rotations.Load()
+}
+
 func (writer *ruleFileWriter) String() string {
 	return "ruleFileWriter: fileNameFormatter=(" + writer.fileNameFormatter.String() + ")" +
 		", allowedMaxSize=" + fmt.Sprint(writer.allowedMaxFileSize) +